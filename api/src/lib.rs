@@ -32,4 +32,34 @@ mod tests {
         println!("name = {}", v1alpha1::Clair::crd_name());
         println!("kind = {}", v1alpha1::Clair::kind(&()));
     }
+
+    #[test]
+    fn add_condition_keeps_transition_time() {
+        use k8s_openapi::apimachinery::pkg::apis::meta::v1::{Condition, Time};
+        use k8s_openapi::chrono::{TimeZone, Utc};
+        use v1alpha1::StatusCommon;
+
+        let cnd = |status: &str, secs: i64| Condition {
+            last_transition_time: Time(Utc.timestamp_opt(secs, 0).unwrap()),
+            observed_generation: None,
+            type_: "Ready".into(),
+            status: status.into(),
+            reason: "Test".into(),
+            message: String::new(),
+        };
+        let mut status = v1alpha1::ClairStatus::default();
+        status.add_condition(cnd("True", 1));
+        status.add_condition(cnd("True", 2));
+        assert_eq!(status.conditions.len(), 1);
+        assert_eq!(
+            status.conditions[0].last_transition_time,
+            cnd("True", 1).last_transition_time
+        );
+        status.add_condition(cnd("False", 3));
+        assert_eq!(status.conditions.len(), 1);
+        assert_eq!(
+            status.conditions[0].last_transition_time,
+            cnd("False", 3).last_transition_time
+        );
+    }
 }
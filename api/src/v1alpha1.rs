@@ -1,4 +1,6 @@
 //! Module `v1alpha1` implements the v1alpha1 Clair CRD API.
+use std::collections::BTreeMap;
+
 use k8s_openapi::{api::core, apimachinery::pkg::apis::meta, merge_strategies, DeepMerge};
 use kube::CustomResource;
 use schemars::JsonSchema;
@@ -21,7 +23,8 @@ use validator::Validate;
 )]
 #[serde(rename_all = "camelCase")]
 pub struct ClairSpec {
-    /// .
+    /// Image is the container image used for the Indexer, Matcher, and Notifier this Clair
+    /// manages, unless they specify one themselves.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub image: Option<String>,
     /// Databases indicates the Secret keys holding config drop-ins that services should connect
@@ -51,6 +54,20 @@ pub struct ClairSpec {
     /// This setting affects what format config drop-ins must be in.
     #[serde(default, skip_serializing_if = "Option::is_none")]
     pub config_dialect: Option<ConfigDialect>,
+    /// Hibernate scales the managed Deployments to zero while keeping all other objects.
+    ///
+    /// The previous replica counts are restored when this is unset.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub hibernate: Option<bool>,
+    /// Common_labels are added to every object created for this Clair.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub common_labels: Option<BTreeMap<String, String>>,
+    /// Common_annotations are added to every object created for this Clair.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub common_annotations: Option<BTreeMap<String, String>>,
+    /// Service_mesh injects the Indexer and Matcher pods into the named service mesh.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub service_mesh: Option<ServiceMesh>,
 }
 
 impl ClairSpec {
@@ -95,6 +112,18 @@ impl DeepMerge for ClairSpec {
         self.notifier.merge_from(other.notifier);
         merge_strategies::list::set(self.dropins.as_mut(), other.dropins);
         self.config_dialect.merge_from(other.config_dialect);
+        self.hibernate.merge_from(other.hibernate);
+        merge_strategies::map::granular(
+            &mut self.common_labels,
+            other.common_labels,
+            |cur, new| cur.merge_from(new),
+        );
+        merge_strategies::map::granular(
+            &mut self.common_annotations,
+            other.common_annotations,
+            |cur, new| cur.merge_from(new),
+        );
+        self.service_mesh.merge_from(other.service_mesh);
     }
 }
 
@@ -136,12 +165,35 @@ pub struct Endpoint {
     /// TLS inicates the `kubernetes.io/tls`-typed Secret that should be used.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub tls: Option<core::v1::LocalObjectReference>,
+    /// External_dns requests annotations for external-dns be added to the created frontend.
+    ///
+    /// The "hostname" field must also be set.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub external_dns: Option<ExternalDns>,
 }
 
 impl DeepMerge for Endpoint {
     fn merge_from(&mut self, other: Self) {
         self.hostname.merge_from(other.hostname);
         self.tls.merge_from(other.tls);
+        self.external_dns.merge_from(other.external_dns);
+    }
+}
+
+/// ExternalDns describes how external-dns should manage the record for an Endpoint.
+///
+/// See <https://github.com/kubernetes-sigs/external-dns> for details.
+#[derive(Clone, Default, Debug, Deserialize, PartialEq, Serialize, Validate, JsonSchema)]
+#[serde(rename_all = "camelCase")]
+pub struct ExternalDns {
+    /// TTL is the TTL, in seconds, for the created DNS record. It must be positive.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub ttl: Option<i64>,
+}
+
+impl DeepMerge for ExternalDns {
+    fn merge_from(&mut self, other: Self) {
+        self.ttl.merge_from(other.ttl);
     }
 }
 
@@ -150,6 +202,11 @@ impl DeepMerge for Endpoint {
 #[serde(rename_all = "camelCase")]
 pub struct ClairStatus {
     /// Conditions reports k8s-style conditions for various parts of the system.
+    ///
+    /// The "Ready", "Progressing", and "Degraded" conditions summarize the whole instance, naming
+    /// the affected components in their messages. Their reasons are "ComponentsAvailable" or
+    /// "ComponentsUnavailable", "ComponentsPending" or "ComponentsSettled", and
+    /// "ComponentsFailing" or "ComponentsHealthy", respectively.
     #[serde(default, skip_serializing_if = "Vec::is_empty")]
     //#[schemars(schema_with = "conditions")]
     pub conditions: Vec<meta::v1::Condition>,
@@ -183,6 +240,14 @@ pub struct ClairStatus {
     /// Current_version is the current verison of a deployed Clair instance.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub current_version: Option<String>,
+    /// Image is the image every component last finished rolling out. It's what the components are
+    /// rolled back to if the Matcher fails to roll out a new image.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub image: Option<String>,
+    /// Failed_image is an image that was rolled back because the Matcher failed to roll it out. It
+    /// isn't tried again until "spec.image" changes.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub failed_image: Option<String>,
     /*
     /// Database is the Service for the managed database engine, if used.
     #[serde(skip_serializing_if = "Option::is_none")]
@@ -206,6 +271,26 @@ pub struct ConfigSource {
     pub dropins: Vec<DropinSource>,
 }
 
+impl ConfigSource {
+    /// Uses_config_map reports whether the ConfigMap `name` is referenced.
+    pub fn uses_config_map(&self, name: &str) -> bool {
+        self.root.name == name
+            || self
+                .dropins
+                .iter()
+                .filter_map(|d| d.config_map_key_ref.as_ref())
+                .any(|r| r.name == name)
+    }
+
+    /// Uses_secret reports whether the Secret `name` is referenced.
+    pub fn uses_secret(&self, name: &str) -> bool {
+        self.dropins
+            .iter()
+            .filter_map(|d| d.secret_key_ref.as_ref())
+            .any(|r| r.name == name)
+    }
+}
+
 impl DeepMerge for ConfigSource {
     fn merge_from(&mut self, other: Self) {
         self.root.merge_from(other.root);
@@ -331,6 +416,60 @@ impl DeepMerge for ConfigDialect {
     }
 }
 
+/// VerticalAutoscaling selects how a VerticalPodAutoscaler applies its recommendations.
+///
+/// See <https://github.com/kubernetes/autoscaler/tree/master/vertical-pod-autoscaler> for details.
+#[derive(Clone, Copy, Debug, Deserialize, PartialEq, Serialize, JsonSchema)]
+pub enum VerticalAutoscaling {
+    /// Off only records recommendations.
+    Off,
+    /// Initial applies recommendations to newly created pods.
+    Initial,
+    /// Auto applies recommendations, evicting pods as needed.
+    Auto,
+}
+
+impl std::fmt::Display for VerticalAutoscaling {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            VerticalAutoscaling::Off => write!(f, "Off"),
+            VerticalAutoscaling::Initial => write!(f, "Initial"),
+            VerticalAutoscaling::Auto => write!(f, "Auto"),
+        }
+    }
+}
+
+impl DeepMerge for VerticalAutoscaling {
+    fn merge_from(&mut self, other: Self) {
+        *self = other;
+    }
+}
+
+/// ServiceMesh selects the service mesh the managed pods are injected into.
+#[derive(Clone, Copy, Debug, Deserialize, PartialEq, Serialize, JsonSchema)]
+#[serde(rename_all = "lowercase")]
+pub enum ServiceMesh {
+    /// Istio injects an Istio sidecar.
+    Istio,
+    /// Linkerd injects a Linkerd proxy.
+    Linkerd,
+}
+
+impl std::fmt::Display for ServiceMesh {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            ServiceMesh::Istio => write!(f, "istio"),
+            ServiceMesh::Linkerd => write!(f, "linkerd"),
+        }
+    }
+}
+
+impl DeepMerge for ServiceMesh {
+    fn merge_from(&mut self, other: Self) {
+        *self = other;
+    }
+}
+
 // ImageRef exists to have some Object to hang pre/post Jobs off of.
 // I don't think this is actually needed -- The can/could be driven off of a Condition.
 /*
@@ -379,15 +518,163 @@ pub struct IndexerSpec {
     /// Image is the image that should be used in the managed deployment.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub image: Option<String>,
-    /// Config is configuration sources for the Clair instance.
+    /// Config is the configuration sources the managed Indexer pods are started with.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub config: Option<ConfigSource>,
+    /// Rollout tunes how the managed Deployment rolls out changes.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub rollout: Option<Rollout>,
+    /// Dns_policy sets the DNS policy for the managed pods.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub dns_policy: Option<String>,
+    /// Dns_config is additional DNS configuration for the managed pods.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub dns_config: Option<core::v1::PodDNSConfig>,
+    /// Host_aliases are entries added to the managed pods' hosts file.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub host_aliases: Vec<core::v1::HostAlias>,
+    /// Hibernate scales the managed Deployment to zero.
+    ///
+    /// The previous replica count is restored when this is unset.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub hibernate: Option<bool>,
+    /// Vertical_autoscaling creates a VerticalPodAutoscaler for the managed Deployment, if the
+    /// cluster serves them.
+    ///
+    /// The VerticalPodAutoscaler only manages memory, as CPU is left to the
+    /// HorizontalPodAutoscaler.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub vertical_autoscaling: Option<VerticalAutoscaling>,
+    /// Common_labels are added to every object created for this instance.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub common_labels: Option<BTreeMap<String, String>>,
+    /// Common_annotations are added to every object created for this instance.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub common_annotations: Option<BTreeMap<String, String>>,
+    /// Deployment names an existing Deployment to use instead of a templated one.
+    ///
+    /// The operator only annotates its pod template with the config digest, points the Service
+    /// at its pods, and reports on its rollout. Everything else, including the image, config
+    /// mounts, scaling, and an "api" container port, is up to its owner. Hibernate has no effect
+    /// on it, and no HorizontalPodAutoscaler or VerticalPodAutoscaler is managed for it.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub deployment: Option<String>,
+    /// Service_mesh injects the managed pods into the named service mesh.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub service_mesh: Option<ServiceMesh>,
+    /// Runtime_env sets GOMAXPROCS and GOMEMLIMIT from the managed container's resources, so the
+    /// Go runtime keeps within them. This defaults to true; set it to false to use the runtime's
+    /// own defaults.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub runtime_env: Option<bool>,
+    /// Config_history is how many snapshots of past configs to keep. A snapshot can be run
+    /// instead of the current config by setting the "projectclair.io/rollback-to" annotation to
+    /// its digest, or a unique prefix of at least 8 characters. No snapshots are kept if this is
+    /// unset or zero.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub config_history: Option<u16>,
+    /// Scratch configures the space layers are unpacked into, mounted at /tmp.
+    ///
+    /// Indexing large images can need a lot of space, so this should be set for any Indexer
+    /// expected to see them.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub scratch: Option<Scratch>,
 }
 
 impl DeepMerge for IndexerSpec {
     fn merge_from(&mut self, other: Self) {
         self.image.merge_from(other.image);
         self.config.merge_from(other.config);
+        self.rollout.merge_from(other.rollout);
+        self.dns_policy.merge_from(other.dns_policy);
+        self.dns_config.merge_from(other.dns_config);
+        merge_strategies::list::atomic(&mut self.host_aliases, other.host_aliases);
+        self.hibernate.merge_from(other.hibernate);
+        self.vertical_autoscaling
+            .merge_from(other.vertical_autoscaling);
+        merge_strategies::map::granular(
+            &mut self.common_labels,
+            other.common_labels,
+            |cur, new| cur.merge_from(new),
+        );
+        merge_strategies::map::granular(
+            &mut self.common_annotations,
+            other.common_annotations,
+            |cur, new| cur.merge_from(new),
+        );
+        self.deployment.merge_from(other.deployment);
+        self.service_mesh.merge_from(other.service_mesh);
+        self.scratch.merge_from(other.scratch);
+        self.runtime_env.merge_from(other.runtime_env);
+        self.config_history.merge_from(other.config_history);
+    }
+}
+
+/// Rollout holds the Deployment fields that control how changes are rolled out.
+#[derive(Clone, Default, Debug, Deserialize, PartialEq, Serialize, Validate, JsonSchema)]
+#[serde(rename_all = "camelCase")]
+pub struct Rollout {
+    /// Min_ready_seconds is how long a new pod must be ready before it counts as available.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub min_ready_seconds: Option<i32>,
+    /// Progress_deadline_seconds is how long a rollout may go without progress before it's
+    /// considered failed.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub progress_deadline_seconds: Option<i32>,
+    /// Revision_history_limit is how many old ReplicaSets to keep for rollbacks.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub revision_history_limit: Option<i32>,
+}
+
+impl DeepMerge for Rollout {
+    fn merge_from(&mut self, other: Self) {
+        self.min_ready_seconds.merge_from(other.min_ready_seconds);
+        self.progress_deadline_seconds
+            .merge_from(other.progress_deadline_seconds);
+        self.revision_history_limit
+            .merge_from(other.revision_history_limit);
+    }
+}
+
+/// Scratch configures the area the Indexer unpacks layers into while indexing.
+#[derive(Clone, Debug, Deserialize, PartialEq, Serialize, Validate, JsonSchema)]
+#[serde(rename_all = "camelCase")]
+pub struct Scratch {
+    /// Size is how much space to set aside.
+    ///
+    /// An EmptyDir volume is limited to this size and the container requests it as ephemeral
+    /// storage. An Ephemeral volume's claim requests this much storage.
+    pub size: k8s_openapi::apimachinery::pkg::api::resource::Quantity,
+    /// Volume selects what backs the scratch area. The default is EmptyDir.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub volume: Option<ScratchVolume>,
+    /// Storage_class_name is the StorageClass an Ephemeral volume is provisioned from. The
+    /// cluster's default is used if unset.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub storage_class_name: Option<String>,
+}
+
+impl DeepMerge for Scratch {
+    fn merge_from(&mut self, other: Self) {
+        self.size.merge_from(other.size);
+        self.volume.merge_from(other.volume);
+        self.storage_class_name.merge_from(other.storage_class_name);
+    }
+}
+
+/// ScratchVolume is the kind of volume backing the Indexer's scratch area.
+#[derive(Clone, Copy, Debug, Default, Deserialize, PartialEq, Serialize, JsonSchema)]
+pub enum ScratchVolume {
+    /// EmptyDir uses node-local ephemeral storage.
+    #[default]
+    EmptyDir,
+    /// Ephemeral uses a PersistentVolumeClaim created along with, and deleted with, each pod.
+    Ephemeral,
+}
+
+impl DeepMerge for ScratchVolume {
+    fn merge_from(&mut self, other: Self) {
+        *self = other;
     }
 }
 
@@ -403,9 +690,12 @@ pub struct IndexerStatus {
     /// Refs holds on to references to objects needed by this instance.
     #[serde(default, skip_serializing_if = "Vec::is_empty")]
     pub refs: Vec<core::v1::TypedLocalObjectReference>,
-    /// Config is configuration sources for the Clair instance.
+    /// Config is the configuration sources the managed Deployment is currently rolled out with.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub config: Option<ConfigSource>,
+    /// Image is the image the managed pods are running, pinned by digest.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub image: Option<String>,
 }
 
 /// MatcherSpec describes the desired state of an Matcher instance.
@@ -426,9 +716,61 @@ pub struct IndexerStatus {
 pub struct MatcherSpec {
     /// Image is the image that should be used in the managed deployment.
     pub image: Option<String>,
-    /// Config is configuration sources for the Clair instance.
+    /// Config is the configuration sources the managed Matcher pods are started with.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub config: Option<ConfigSource>,
+    /// Rollout tunes how the managed Deployment rolls out changes.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub rollout: Option<Rollout>,
+    /// Dns_policy sets the DNS policy for the managed pods.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub dns_policy: Option<String>,
+    /// Dns_config is additional DNS configuration for the managed pods.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub dns_config: Option<core::v1::PodDNSConfig>,
+    /// Host_aliases are entries added to the managed pods' hosts file.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub host_aliases: Vec<core::v1::HostAlias>,
+    /// Hibernate scales the managed Deployment to zero.
+    ///
+    /// The previous replica count is restored when this is unset.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub hibernate: Option<bool>,
+    /// Vertical_autoscaling creates a VerticalPodAutoscaler for the managed Deployment, if the
+    /// cluster serves them.
+    ///
+    /// The VerticalPodAutoscaler only manages memory, as CPU is left to the
+    /// HorizontalPodAutoscaler.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub vertical_autoscaling: Option<VerticalAutoscaling>,
+    /// Common_labels are added to every object created for this instance.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub common_labels: Option<BTreeMap<String, String>>,
+    /// Common_annotations are added to every object created for this instance.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub common_annotations: Option<BTreeMap<String, String>>,
+    /// Deployment names an existing Deployment to use instead of a templated one.
+    ///
+    /// The operator only annotates its pod template with the config digest, points the Service
+    /// at its pods, and reports on its rollout. Everything else, including the image, config
+    /// mounts, scaling, and an "api" container port, is up to its owner. Hibernate has no effect
+    /// on it, and no HorizontalPodAutoscaler or VerticalPodAutoscaler is managed for it.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub deployment: Option<String>,
+    /// Service_mesh injects the managed pods into the named service mesh.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub service_mesh: Option<ServiceMesh>,
+    /// Runtime_env sets GOMAXPROCS and GOMEMLIMIT from the managed container's resources, so the
+    /// Go runtime keeps within them. This defaults to true; set it to false to use the runtime's
+    /// own defaults.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub runtime_env: Option<bool>,
+    /// Config_history is how many snapshots of past configs to keep. A snapshot can be run
+    /// instead of the current config by setting the "projectclair.io/rollback-to" annotation to
+    /// its digest, or a unique prefix of at least 8 characters. No snapshots are kept if this is
+    /// unset or zero.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub config_history: Option<u16>,
 }
 /// MatcherStatus describes the observed state of a Matcher instance.
 #[derive(Clone, Debug, Default, Deserialize, PartialEq, Serialize, Validate, JsonSchema)]
@@ -442,9 +784,12 @@ pub struct MatcherStatus {
     /// Refs holds on to references to objects needed by this instance.
     #[serde(default, skip_serializing_if = "Vec::is_empty")]
     pub refs: Vec<core::v1::TypedLocalObjectReference>,
-    /// Config is configuration sources for the Clair instance.
+    /// Config is the configuration sources the managed Deployment is currently rolled out with.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub config: Option<ConfigSource>,
+    /// Image is the image the managed pods are running, pinned by digest.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub image: Option<String>,
 }
 
 /// UpdaterSpec describes the desired state of an Updater instance.
@@ -475,9 +820,9 @@ pub struct UpdaterSpec {
     #[serde(skip_serializing_if = "Option::is_none")]
     pub suspend: Option<bool>,
 
-    /// Image is the image that should be used in the managed deployment.
+    /// Image is the image that should be used in the managed CronJob.
     pub image: Option<String>,
-    /// Config is configuration sources for the Clair instance.
+    /// Config is the configuration sources the managed CronJob's pods are started with.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub config: Option<ConfigSource>,
 }
@@ -497,7 +842,7 @@ pub struct UpdaterStatus {
     /// CronJob the operator has configured for this Updater.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub cron_job: Option<core::v1::TypedLocalObjectReference>,
-    /// Config is configuration sources for the Clair instance.
+    /// Config is the configuration sources the managed CronJob is currently configured with.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub config: Option<ConfigSource>,
 }
@@ -520,7 +865,7 @@ pub struct UpdaterStatus {
 pub struct NotifierSpec {
     /// Image is the image that should be used in the managed deployment.
     pub image: Option<String>,
-    /// Config is configuration sources for the Clair instance.
+    /// Config is the configuration sources the managed Notifier pods are started with.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub config: Option<ConfigSource>,
 }
@@ -536,7 +881,7 @@ pub struct NotifierStatus {
     /// Refs holds on to references to objects needed by this instance.
     #[serde(default, skip_serializing_if = "Vec::is_empty")]
     pub refs: Vec<core::v1::TypedLocalObjectReference>,
-    /// Config is configuration sources for the Clair instance.
+    /// Config is the configuration sources the managed Deployment is currently rolled out with.
     #[serde(skip_serializing_if = "Option::is_none")]
     pub config: Option<ConfigSource>,
 }
@@ -622,7 +967,10 @@ impl_crds!(
 /// StatusCommon is common helpers for dealing with status objects.
 pub trait StatusCommon: private::StatusCommon {
     /// Add_condition adds a Condition, ensuring the list is deduplicated.
-    fn add_condition(&mut self, cnd: meta::v1::Condition) {
+    ///
+    /// If a Condition of the same type and status is already present, its transition time is
+    /// kept.
+    fn add_condition(&mut self, mut cnd: meta::v1::Condition) {
         use self::meta::v1::Condition;
         let mut found = false;
         let mut out: Vec<Condition> = self
@@ -631,12 +979,14 @@ pub trait StatusCommon: private::StatusCommon {
             .map(|c| {
                 if c.type_ == cnd.type_ {
                     found = true;
-                    &cnd
+                    if c.status == cnd.status {
+                        cnd.last_transition_time = c.last_transition_time.clone();
+                    }
+                    cnd.clone()
                 } else {
-                    c
+                    c.clone()
                 }
             })
-            .cloned()
             .collect();
         if !found {
             out.push(cnd);
@@ -677,6 +1027,21 @@ pub trait StatusCommon: private::StatusCommon {
         self.set_refs(out);
     }
 
+    /// Remove_ref removes the reference for the type `K`, if present.
+    fn remove_ref<K>(&mut self)
+    where
+        K: kube::Resource<DynamicType = ()>,
+    {
+        let kind = K::kind(&());
+        let out = self
+            .get_refs()
+            .iter()
+            .filter(|r| r.kind != kind)
+            .cloned()
+            .collect();
+        self.set_refs(out);
+    }
+
     /// Has_ref returns the reference for the type `K`, if present.
     fn has_ref<K>(&self) -> Option<core::v1::TypedLocalObjectReference>
     where
@@ -747,6 +1112,30 @@ impl_spec!(
     UpdaterSpec,
 );
 
+/// CommonMetadata is implemented by the kinds that carry labels and annotations to add to every
+/// object created on their behalf.
+pub trait CommonMetadata {
+    /// Common_labels returns the labels to add to created objects.
+    fn common_labels(&self) -> Option<&BTreeMap<String, String>>;
+    /// Common_annotations returns the annotations to add to created objects.
+    fn common_annotations(&self) -> Option<&BTreeMap<String, String>>;
+}
+macro_rules! impl_common_metadata {
+    ($($kind:ty),+ $(,)?) => {
+        $(
+        impl CommonMetadata for $kind {
+            fn common_labels(&self) -> Option<&BTreeMap<String, String>> {
+                self.spec.common_labels.as_ref()
+            }
+            fn common_annotations(&self) -> Option<&BTreeMap<String, String>> {
+                self.spec.common_annotations.as_ref()
+            }
+        }
+        )+
+    };
+}
+impl_common_metadata!(Clair, Indexer, Matcher);
+
 /// SubSpecCommon is helper for the common "subresource" types.
 pub trait SubSpecCommon: private::SubSpecCommon {
     /// Set_values sets the common parts of the spec.
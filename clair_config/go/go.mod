@@ -2,4 +2,7 @@ module github.com/quay/clair-operator/clair_config/go
 
 go 1.20
 
-require github.com/quay/clair/config v1.3.0
+require (
+	github.com/quay/clair/config v1.3.0
+	gopkg.in/yaml.v3 v3.0.1
+)
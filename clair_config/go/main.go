@@ -3,14 +3,18 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
 	"strings"
 
 	"github.com/quay/clair/config"
+	"gopkg.in/yaml.v3"
 )
 
 import "C"
 
-// Validate runs [config.Validate] on the config.
+// Validate runs [config.Validate] on the config, which may be JSON or YAML.
 //
 // Lints and warning are copied into a C allocation and the "out" pointer
 // filled, if provided. If the Go `Validate` function returned an error, the
@@ -42,7 +46,7 @@ func Validate(b []byte, out **C.char, mode string) (exit C.int) {
 
 	exit++
 	cfg.Mode, err = config.ParseMode(mode)
-	err = json.Unmarshal(b, &cfg)
+	err = decode(b, &cfg)
 	if err != nil {
 		return
 	}
@@ -57,6 +61,303 @@ func Validate(b []byte, out **C.char, mode string) (exit C.int) {
 	return
 }
 
+// Lint runs [config.Lint] on the config.
+//
+// Lints are copied into a C allocation and the "out" pointer filled, as with
+// Validate. Unlike Validate, lints are reported for configs that would not pass
+// validation; the return is only non-zero if the config could not be decoded or
+// the lints could not be run.
+//
+// [config.Lint]: https://pkg.go.dev/github.com/quay/clair/config#Lint
+//
+//export Lint
+func Lint(b []byte, out **C.char) (exit C.int) {
+	var buf strings.Builder
+	var cfg config.Config
+	var err error
+	defer func() {
+		if err != nil {
+			buf.Reset()
+			buf.WriteString(err.Error())
+		} else {
+			exit = 0
+		}
+		*out = C.CString(buf.String())
+	}()
+
+	exit++
+	err = decode(b, &cfg)
+	if err != nil {
+		return
+	}
+
+	var ws []config.Warning
+	exit++
+	ws, err = config.Lint(&cfg)
+	for _, w := range ws {
+		fmt.Fprintln(&buf, w.Error())
+	}
+	return
+}
+
+// Defaults runs [config.Validate] on the config and reports the resulting
+// config, with defaults filled in, as JSON.
+//
+// The JSON is copied into a C allocation and the "out" pointer filled. If the
+// config is invalid for the mode, the return is non-zero and "out" holds the
+// error, as with Validate.
+//
+// [config.Validate]: https://pkg.go.dev/github.com/quay/clair/config#Validate
+//
+//export Defaults
+func Defaults(b []byte, out **C.char, mode string) (exit C.int) {
+	var buf []byte
+	var cfg config.Config
+	var err error
+	defer func() {
+		if err != nil {
+			buf = []byte(err.Error())
+		} else {
+			exit = 0
+		}
+		*out = C.CString(string(buf))
+	}()
+
+	exit++
+	cfg.Mode, err = config.ParseMode(mode)
+	if err != nil {
+		return
+	}
+
+	exit++
+	err = decode(b, &cfg)
+	if err != nil {
+		return
+	}
+
+	exit++
+	if _, err = config.Validate(&cfg); err != nil {
+		return
+	}
+
+	exit++
+	buf, err = json.Marshal(&cfg)
+	return
+}
+
+// Diagnostic is a single problem found in a config.
+type diagnostic struct {
+	// Severity is "error" for problems that fail validation and "warning" for
+	// lints.
+	Severity string `json:"severity"`
+	// Path is the JSON path of the offending value, if known.
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// Diagnose runs [config.Validate] on the config and reports the results as a
+// JSON array of diagnostics, instead of the newline-joined strings Validate
+// returns.
+//
+// A config that fails validation is not a failure of this function: the error
+// is reported as a diagnostic with "error" severity. The return is only
+// non-zero if "mode" is invalid, in which case "out" holds the error.
+//
+// [config.Validate]: https://pkg.go.dev/github.com/quay/clair/config#Validate
+//
+//export Diagnose
+func Diagnose(b []byte, out **C.char, mode string) (exit C.int) {
+	var buf []byte
+	var cfg config.Config
+	var err error
+	defer func() {
+		if err != nil {
+			buf = []byte(err.Error())
+		} else {
+			exit = 0
+		}
+		*out = C.CString(string(buf))
+	}()
+
+	exit++
+	cfg.Mode, err = config.ParseMode(mode)
+	if err != nil {
+		return
+	}
+
+	ds := []diagnostic{}
+	if derr := decode(b, &cfg); derr != nil {
+		ds = append(ds, diagnostic{Severity: "error", Message: derr.Error()})
+	} else {
+		ws, verr := config.Validate(&cfg)
+		for i := range ws {
+			msg, path := warningParts(&ws[i])
+			ds = append(ds, diagnostic{Severity: "warning", Path: path, Message: msg})
+		}
+		if verr != nil {
+			ds = append(ds, diagnostic{Severity: "error", Message: verr.Error()})
+		}
+	}
+
+	exit++
+	buf, err = json.Marshal(ds)
+	return
+}
+
+// WarningParts returns the message and path of a lint warning.
+//
+// [config.Warning] doesn't export its path, so it's read from the struct field
+// rather than parsed back out of the Error string. If the fields go away, the
+// whole Error string is used as the message and the path is left empty.
+func warningParts(w *config.Warning) (msg, path string) {
+	v := reflect.ValueOf(w).Elem()
+	if f := v.FieldByName("path"); f.Kind() == reflect.String {
+		path = f.String()
+	}
+	switch inner := w.Unwrap(); {
+	case inner != nil:
+		msg = inner.Error()
+	case v.FieldByName("msg").Kind() == reflect.String:
+		msg = v.FieldByName("msg").String()
+	}
+	if msg == "" {
+		msg, path = w.Error(), ""
+	}
+	return msg, path
+}
+
+// Diff reports the paths of the fields that differ between the configs in "a"
+// and "b", as a JSON array of strings.
+//
+// Both configs are decoded into a [config.Config] first, so differences in
+// formatting, dialect, or unknown keys are not reported. Paths use the same
+// "$.section.field" form as lint warnings. The JSON is copied into a C
+// allocation and the "out" pointer filled; if either config can't be decoded,
+// the return is non-zero and "out" holds the error.
+//
+//export Diff
+func Diff(a, b []byte, out **C.char) (exit C.int) {
+	var buf []byte
+	var ca, cb config.Config
+	var va, vb interface{}
+	var err error
+	defer func() {
+		if err != nil {
+			buf = []byte(err.Error())
+		} else {
+			exit = 0
+		}
+		*out = C.CString(string(buf))
+	}()
+
+	exit++
+	if err = decode(a, &ca); err != nil {
+		return
+	}
+	exit++
+	if err = decode(b, &cb); err != nil {
+		return
+	}
+
+	exit++
+	if va, err = normalize(&ca); err != nil {
+		return
+	}
+	if vb, err = normalize(&cb); err != nil {
+		return
+	}
+	changed := []string{}
+	diffValues("$", va, vb, &changed)
+
+	exit++
+	buf, err = json.Marshal(changed)
+	return
+}
+
+// Normalize round-trips "cfg" through JSON, so that it can be compared
+// generically.
+func normalize(cfg *config.Config) (v interface{}, err error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &v)
+	return v, err
+}
+
+// DiffValues appends the paths under "path" that differ between "a" and "b"
+// to "changed". Objects are compared key-by-key; anything else is compared as
+// a whole.
+func diffValues(path string, a, b interface{}, changed *[]string) {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if !aok || !bok {
+		if !reflect.DeepEqual(a, b) {
+			*changed = append(*changed, path)
+		}
+		return
+	}
+	keys := make([]string, 0, len(am)+len(bm))
+	for k := range am {
+		keys = append(keys, k)
+	}
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		diffValues(path+"."+k, am[k], bm[k], changed)
+	}
+}
+
+// Version reports the version of the [config] module this bridge was built
+// with.
+//
+// Clair configs don't carry a version of their own, so there's nothing to
+// detect in a config document: the module version determines the schema that
+// configs are decoded and validated against.
+//
+// The version is copied into a C allocation and the "out" pointer filled. The
+// return is non-zero if the build information is unavailable.
+//
+// [config]: https://pkg.go.dev/github.com/quay/clair/config
+//
+//export Version
+func Version(out **C.char) (exit C.int) {
+	const mod = "github.com/quay/clair/config"
+	v := "build information unavailable"
+	defer func() {
+		*out = C.CString(v)
+	}()
+
+	exit++
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, d := range bi.Deps {
+		if d.Path == mod {
+			if d.Replace != nil {
+				d = d.Replace
+			}
+			v = d.Version
+			return 0
+		}
+	}
+	v = "module missing from build information: " + mod
+	return
+}
+
+// Decode decodes the config in "b", which may be JSON or YAML.
+func decode(b []byte, cfg *config.Config) error {
+	if json.Valid(b) {
+		return json.Unmarshal(b, cfg)
+	}
+	return yaml.Unmarshal(b, cfg)
+}
+
 func main() {
 	panic("not a real main -- build as c-archive")
 }
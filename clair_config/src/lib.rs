@@ -97,6 +97,61 @@ impl Parts {
     /// [`config.Validate`]: https://pkg.go.dev/github.com/quay/clair/config#Validate
     /// [`cmd.Load`]: https://pkg.go.dev/github.com/quay/clair/v4/cmd#Load
     pub async fn validate(&self) -> Result<Validate> {
+        let doc = self.render()?;
+        Ok(Validate {
+            indexer: validate_config(&doc, "indexer").await,
+            matcher: validate_config(&doc, "matcher").await,
+            notifier: validate_config(&doc, "notifier").await,
+
+            updater: validate_config(&doc, "updater").await,
+        })
+    }
+
+    /// Lint calls into [`config.Lint`] and reports the lints for the composed config.
+    ///
+    /// Unlike [`Parts::validate`], lints are reported even if the config isn't valid for any
+    /// mode, so they can be presented separately from validation failures.
+    ///
+    /// [`config.Lint`]: https://pkg.go.dev/github.com/quay/clair/config#Lint
+    pub async fn lint(&self) -> Result<Warnings> {
+        let doc = self.render()?;
+        lint_config(&doc).await
+    }
+
+    /// Defaults reports the composed config as Clair would run it in `mode`, with the defaults
+    /// filled in by [`config.Validate`].
+    ///
+    /// An error is returned if the config isn't valid for `mode`.
+    ///
+    /// [`config.Validate`]: https://pkg.go.dev/github.com/quay/clair/config#Validate
+    pub async fn defaults<S: AsRef<str>>(&self, mode: S) -> Result<serde_json::Value> {
+        let doc = self.render()?;
+        let buf = defaults_config(&doc, mode).await?;
+        Ok(serde_json::from_str(&buf)?)
+    }
+
+    /// Diagnose validates the composed config for `mode`, reporting lints and failures as
+    /// structured [`Diagnostic`]s.
+    ///
+    /// A config that fails validation is reported through an [`Severity::Error`] diagnostic
+    /// rather than an error.
+    pub async fn diagnose<S: AsRef<str>>(&self, mode: S) -> Result<Vec<Diagnostic>> {
+        let doc = self.render()?;
+        diagnose_config(&doc, mode).await
+    }
+
+    /// Diff reports the JSON paths of the config fields that differ between this composed config
+    /// and `other`.
+    ///
+    /// Differences that Clair wouldn't see, such as formatting or unknown keys, are not reported.
+    pub async fn diff(&self, other: &Parts) -> Result<Vec<String>> {
+        let a = self.render()?;
+        let b = other.render()?;
+        diff_config(&a, &b).await
+    }
+
+    /// Render composes the root and dropins into a single JSON document.
+    fn render(&self) -> Result<Vec<u8>> {
         let doc = serde_json::from_slice(&self.root)?;
         let doc = self
             .dropins
@@ -116,14 +171,7 @@ impl Parts {
                 doc
             });
         trace!("config rendered");
-        let doc = serde_json::to_vec(&doc)?;
-        Ok(Validate {
-            indexer: validate_config(&doc, "indexer").await,
-            matcher: validate_config(&doc, "matcher").await,
-            notifier: validate_config(&doc, "notifier").await,
-
-            updater: validate_config(&doc, "updater").await,
-        })
+        Ok(serde_json::to_vec(&doc)?)
     }
 }
 
@@ -236,6 +284,50 @@ impl K8sMap for core::v1::Secret {
     }
 }
 
+/// ConfigObject is either kind of object a config file can be stored in.
+///
+/// This lets code that's handed a mix of ConfigMaps and Secrets, such as a ConfigSource's dropins,
+/// treat them the same way.
+#[derive(Clone, Debug)]
+pub enum ConfigObject {
+    /// ConfigMap is a config file stored in a ConfigMap.
+    ConfigMap(core::v1::ConfigMap),
+    /// Secret is a config file stored in a Secret.
+    Secret(core::v1::Secret),
+}
+
+impl ConfigObject {
+    /// Metadata returns the metadata of the underlying object.
+    pub fn metadata(&self) -> &k8s_openapi::apimachinery::pkg::apis::meta::v1::ObjectMeta {
+        match self {
+            Self::ConfigMap(v) => &v.metadata,
+            Self::Secret(v) => &v.metadata,
+        }
+    }
+}
+
+impl From<core::v1::ConfigMap> for ConfigObject {
+    fn from(value: core::v1::ConfigMap) -> Self {
+        Self::ConfigMap(value)
+    }
+}
+
+impl From<core::v1::Secret> for ConfigObject {
+    fn from(value: core::v1::Secret) -> Self {
+        Self::Secret(value)
+    }
+}
+
+impl Sealed for ConfigObject {}
+impl K8sMap for ConfigObject {
+    fn value(&self, key: String) -> Option<Vec<u8>> {
+        match self {
+            Self::ConfigMap(v) => v.value(key),
+            Self::Secret(v) => v.value(key),
+        }
+    }
+}
+
 /// Validate reports results for all the Clair operating modes.
 ///
 /// The "updater" mode is not implemented in the upstream config module yet.
@@ -258,9 +350,25 @@ pub struct Warnings {
     out: String,
 }
 
+impl Warnings {
+    /// Mode reports the mode the config was validated for, or an empty string for lints.
+    pub fn mode(&self) -> &str {
+        &self.mode
+    }
+
+    /// Lints returns the individual lints reported by the validator.
+    pub fn lints(&self) -> impl Iterator<Item = &str> {
+        self.out.lines().filter(|l| !l.is_empty())
+    }
+}
+
 impl std::fmt::Display for Warnings {
     fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
-        writeln!(f, "warnings ({} mode):", self.mode)?;
+        if self.mode.is_empty() {
+            writeln!(f, "warnings:")?;
+        } else {
+            writeln!(f, "warnings ({} mode):", self.mode)?;
+        }
         for w in self.out.lines() {
             writeln!(f, "\t{w}")?;
         }
@@ -287,6 +395,38 @@ impl std::fmt::Debug for Warnings {
     }
 }
 
+/// Version reports the version of the [`github.com/quay/clair/config`] module configs are
+/// validated with.
+///
+/// Clair configs don't carry a version of their own, so this is the schema version.
+///
+/// [`github.com/quay/clair/config`]: https://pkg.go.dev/github.com/quay/clair/config
+pub async fn version() -> Result<String> {
+    use std::ffi;
+    call_go(|out: *mut *mut ffi::c_char| unsafe { sys::Version(out) }).map_err(Error::validation)
+}
+
+/// Diagnostic is a single problem found in a config.
+#[derive(Clone, Debug, serde::Deserialize, PartialEq)]
+pub struct Diagnostic {
+    /// Severity of the problem.
+    pub severity: Severity,
+    /// Path is the JSON path of the offending value, if known.
+    pub path: Option<String>,
+    /// Message describes the problem.
+    pub message: String,
+}
+
+/// Severity is the severity of a [`Diagnostic`].
+#[derive(Clone, Copy, Debug, serde::Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum Severity {
+    /// The config is invalid.
+    Error,
+    /// The config is valid, but possibly not as intended.
+    Warning,
+}
+
 /// To_json returns the bytes jsonified.
 fn to_json(buf: Vec<u8>, flavor: &v1alpha1::ConfigDialect) -> Result<Vec<u8>> {
     match flavor {
@@ -305,41 +445,114 @@ fn to_json(buf: Vec<u8>, flavor: &v1alpha1::ConfigDialect) -> Result<Vec<u8>> {
 ///
 /// [config.Validate]: https://pkg.go.dev/github.com/quay/clair/config#Validate
 async fn validate_config<S: AsRef<str>>(buf: &[u8], mode: S) -> Result<Warnings> {
+    use std::ffi;
+    let mode = mode.as_ref().to_string();
+    let m = go_string(&mode);
+    let buf = go_slice(buf);
+    call_go(|out: *mut *mut ffi::c_char| unsafe { sys::Validate(buf, out, m) })
+        .map_err(Error::validation)
+        .map(|out| Warnings { mode, out })
+}
+
+/// Lint_config wraps a call to [config.Lint].
+///
+/// Lints aren't specific to a mode, so the returned [`Warnings`] have an empty mode.
+///
+/// [config.Lint]: https://pkg.go.dev/github.com/quay/clair/config#Lint
+async fn lint_config(buf: &[u8]) -> Result<Warnings> {
+    use std::ffi;
+    let buf = go_slice(buf);
+    call_go(|out: *mut *mut ffi::c_char| unsafe { sys::Lint(buf, out) })
+        .map_err(Error::validation)
+        .map(|out| Warnings {
+            mode: String::new(),
+            out,
+        })
+}
+
+/// Defaults_config wraps a call to the bridge's `Defaults`, returning the defaulted config as
+/// JSON.
+async fn defaults_config<S: AsRef<str>>(buf: &[u8], mode: S) -> Result<String> {
+    use std::ffi;
+    let mode = mode.as_ref().to_string();
+    let m = go_string(&mode);
+    let buf = go_slice(buf);
+    call_go(|out: *mut *mut ffi::c_char| unsafe { sys::Defaults(buf, out, m) })
+        .map_err(Error::validation)
+}
+
+/// Diagnose_config wraps a call to the bridge's `Diagnose`.
+async fn diagnose_config<S: AsRef<str>>(buf: &[u8], mode: S) -> Result<Vec<Diagnostic>> {
+    use std::ffi;
+    let mode = mode.as_ref().to_string();
+    let m = go_string(&mode);
+    let buf = go_slice(buf);
+    let out = call_go(|out: *mut *mut ffi::c_char| unsafe { sys::Diagnose(buf, out, m) })
+        .map_err(Error::validation)?;
+    Ok(serde_json::from_str(&out)?)
+}
+
+/// Diff_config wraps a call to the bridge's `Diff`.
+async fn diff_config(a: &[u8], b: &[u8]) -> Result<Vec<String>> {
+    use std::ffi;
+    let a = go_slice(a);
+    let b = go_slice(b);
+    let out = call_go(|out: *mut *mut ffi::c_char| unsafe { sys::Diff(a, b, out) })
+        .map_err(Error::validation)?;
+    Ok(serde_json::from_str(&out)?)
+}
+
+/// Go_slice makes the slice that go expects.
+///
+/// The returned value borrows `buf` without a lifetime, so it must not outlive it.
+fn go_slice(buf: &[u8]) -> sys::GoSlice {
+    use std::ffi;
+    sys::GoSlice {
+        data: buf.as_ptr() as *mut ffi::c_void,
+        cap: buf.len() as i64,
+        len: buf.len() as i64,
+    }
+}
+
+/// Go_string makes the string that go expects.
+///
+/// The returned value borrows `s` without a lifetime, so it must not outlive it.
+fn go_string(s: &str) -> sys::GoString {
+    sys::GoString {
+        p: s.as_ptr() as *const i8,
+        n: s.len() as isize,
+    }
+}
+
+/// Call_go calls `f` with a spot for the Go side to put its output, then copies and frees that
+/// output. A non-zero return from `f` is reported as an error holding the output.
+fn call_go<F>(f: F) -> Result<String, String>
+where
+    F: FnOnce(*mut *mut std::ffi::c_char) -> std::ffi::c_int,
+{
     use libc::free;
     use std::ffi::{self, CStr};
     use tokio::task;
     // Allocate a spot to hold the returning string data.
     let mut out: *mut ffi::c_char = std::ptr::null_mut();
-    // Make the slice that go expects.
-    let buf = sys::GoSlice {
-        data: buf.as_ptr() as *mut ffi::c_void,
-        cap: buf.len() as i64,
-        len: buf.len() as i64,
-    };
-    // Make the string that go expects.
-    let mode = mode.as_ref().to_string();
-    let m = sys::GoString {
-        p: mode.as_ptr() as *const i8,
-        n: mode.len() as isize,
-    };
-    // This is a large-ish unsafe block, but the Validate, from_ptr, and free are all unsafe.
-    let res: Result<String, String> = task::block_in_place(|| unsafe {
-        let exit = sys::Validate(buf, &mut out, m);
-        let res = match exit {
-            0 => Ok(CStr::from_ptr(out)
-                .to_str()
-                .expect("programmer error: invalid UTF8 from go side")
-                .to_string()),
-            _ => Err(format!(
-                "{} (exit code {exit})",
-                CStr::from_ptr(out).to_string_lossy()
-            )),
-        };
-        free(out as *mut ffi::c_void);
-        res
-    });
-    res.map_err(Error::validation)
-        .map(|out| Warnings { mode, out })
+    task::block_in_place(|| {
+        let exit = f(&mut out);
+        // The from_ptr and free are unsafe, but the Go side always fills in "out".
+        unsafe {
+            let res = match exit {
+                0 => Ok(CStr::from_ptr(out)
+                    .to_str()
+                    .expect("programmer error: invalid UTF8 from go side")
+                    .to_string()),
+                _ => Err(format!(
+                    "{} (exit code {exit})",
+                    CStr::from_ptr(out).to_string_lossy()
+                )),
+            };
+            free(out as *mut ffi::c_void);
+            res
+        }
+    })
 }
 
 #[cfg(test)]
@@ -370,6 +583,120 @@ mod tests {
         Ok(())
     }
 
+    #[tokio::test(flavor = "multi_thread", worker_threads = 1)]
+    async fn go_config_yaml() -> Result<()> {
+        let buf: Vec<u8> = Vec::from("matcher:\n  indexer_addr: indexer\n");
+        let ws = validate_config(&buf, "matcher").await?;
+        eprintln!("{ws}");
+        Ok(())
+    }
+
+    #[tokio::test(flavor = "multi_thread", worker_threads = 1)]
+    async fn go_config_diagnose() -> Result<()> {
+        let buf: Vec<u8> = Vec::from(r#"{"matcher":{"indexer_addr":"indexer"}}"#);
+        let ds = diagnose_config(&buf, "matcher").await?;
+        eprintln!("{ds:?}");
+        if !ds
+            .iter()
+            .all(|d| d.severity == Severity::Warning && d.path.is_some())
+        {
+            return Err(Error::test("expected only warnings with paths"));
+        }
+
+        let buf: Vec<u8> = Vec::from(r#"{"http_listen_addr":"bogus"}"#);
+        let ds = diagnose_config(&buf, "matcher").await?;
+        eprintln!("{ds:?}");
+        if !ds.iter().any(|d| d.severity == Severity::Error) {
+            return Err(Error::test("expected an error diagnostic"));
+        }
+        Ok(())
+    }
+
+    #[tokio::test(flavor = "multi_thread", worker_threads = 1)]
+    async fn go_config_diff() -> Result<()> {
+        let a: Vec<u8> = Vec::from("matcher:\n  indexer_addr: indexer\n  period: 1h\n");
+        let b: Vec<u8> =
+            Vec::from(r#"{"matcher":{"indexer_addr":"indexer","period":"60m","connstring":"x"}}"#);
+        let changed = diff_config(&a, &b).await?;
+        if changed != ["$.matcher.connstring"] {
+            return Err(Error::test(format!("unexpected changes: {changed:?}")));
+        }
+        if !diff_config(&a, &a).await?.is_empty() {
+            return Err(Error::test("expected no changes"));
+        }
+        Ok(())
+    }
+
+    #[tokio::test(flavor = "multi_thread", worker_threads = 1)]
+    async fn go_config_version() -> Result<()> {
+        let v = version().await?;
+        eprintln!("{v}");
+        if !v.starts_with('v') {
+            return Err(Error::test(format!("unexpected version: {v}")));
+        }
+        Ok(())
+    }
+
+    #[tokio::test(flavor = "multi_thread", worker_threads = 1)]
+    async fn go_config_lint() -> Result<()> {
+        // An unparsable listen address fails validation, but linting should still work.
+        let buf: Vec<u8> = Vec::from(r#"{"http_listen_addr":"bogus"}"#);
+        if validate_config(&buf, "indexer").await.is_ok() {
+            return Err(Error::test("expected validation error"));
+        }
+        let ws = lint_config(&buf).await?;
+        eprintln!("{ws}");
+        if ws.lints().count() == 0 {
+            return Err(Error::test("expected lints"));
+        }
+        Ok(())
+    }
+
+    #[tokio::test(flavor = "multi_thread", worker_threads = 1)]
+    async fn go_config_defaults() -> Result<()> {
+        let buf: Vec<u8> = Vec::from(r#"{"matcher":{"indexer_addr":"indexer"}}"#);
+        let v: serde_json::Value = serde_json::from_str(&defaults_config(&buf, "matcher").await?)?;
+        eprintln!("{v}");
+        match v["http_listen_addr"].as_str() {
+            Some(addr) if !addr.is_empty() => Ok(()),
+            _ => Err(Error::test("expected a default listen address")),
+        }
+    }
+
+    #[test]
+    fn config_object_value() {
+        use k8s_openapi::ByteString;
+        let cm: ConfigObject = core::v1::ConfigMap {
+            data: Some(BTreeMap::from([("a.json".into(), "{}".into())])),
+            ..Default::default()
+        }
+        .into();
+        let sec: ConfigObject = core::v1::Secret {
+            data: Some(BTreeMap::from([(
+                "b.json".into(),
+                ByteString(b"[]".to_vec()),
+            )])),
+            ..Default::default()
+        }
+        .into();
+        assert_eq!(cm.value("a.json".into()), Some(b"{}".to_vec()));
+        assert_eq!(sec.value("b.json".into()), Some(b"[]".to_vec()));
+        assert_eq!(cm.value("b.json".into()), None);
+    }
+
+    #[test]
+    fn warnings_lints() {
+        let ws = Warnings {
+            mode: "indexer".into(),
+            out: "first lint\n\nsecond lint\n".into(),
+        };
+        assert_eq!(ws.mode(), "indexer");
+        assert_eq!(
+            ws.lints().collect::<Vec<_>>(),
+            ["first lint", "second lint"]
+        );
+    }
+
     // TODO(hank) This test will need to be updated when the config go module is updated.
     #[tokio::test(flavor = "multi_thread", worker_threads = 1)]
     async fn go_config_updater() -> Result<()> {
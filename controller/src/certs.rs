@@ -0,0 +1,338 @@
+//! Certs holds a self-signed certificate bootstrapper for the webhook server, for clusters without
+//! cert-manager.
+
+use std::{
+    collections::BTreeMap,
+    path::{Path, PathBuf},
+    time::Duration,
+};
+
+use k8s_openapi::{
+    api::admissionregistration::v1::{
+        MutatingWebhookConfiguration, ValidatingWebhookConfiguration,
+    },
+    ByteString,
+};
+use openssl::{
+    asn1::{Asn1Integer, Asn1Time},
+    bn::{BigNum, MsbOption},
+    hash::MessageDigest,
+    pkey::{PKey, Private},
+    rsa::Rsa,
+    x509::{
+        extension::{BasicConstraints, ExtendedKeyUsage, KeyUsage, SubjectAlternativeName},
+        X509NameBuilder, X509,
+    },
+};
+
+use crate::prelude::*;
+
+/// VALID_DAYS is how long generated certificates are valid for.
+const VALID_DAYS: u32 = 365;
+/// RENEW_DAYS is how close to expiry a certificate may get before it's replaced.
+const RENEW_DAYS: u32 = 30;
+/// CHECK_INTERVAL is how often every replica runs [`ensure`].
+const CHECK_INTERVAL: Duration = Duration::from_secs(3600);
+/// ROTATION_GRACE is how long a replaced CA stays in the webhook configurations' CA bundle, so
+/// replicas still serving the old certificate are trusted until their next check picks up the new
+/// one.
+const ROTATION_GRACE: Duration = Duration::from_secs(2 * 3600);
+/// PREVIOUS_CA is the Secret key holding the CA that the current one replaced.
+const PREVIOUS_CA: &str = "previous-ca.crt";
+
+/// Config is the configuration for the certificate bootstrapper.
+#[derive(Clone, Debug)]
+pub struct Config {
+    /// Secret is the name of the Secret to store the certificates in.
+    pub secret: String,
+    /// Service is the name of the webhook Service the certificate is for.
+    pub service: String,
+    /// Cluster_domain is the cluster's DNS domain, used for the fully-qualified Service name.
+    pub cluster_domain: String,
+    /// Webhooks are the names of the Validating- and MutatingWebhookConfigurations to inject the
+    /// CA into.
+    pub webhooks: Vec<String>,
+    /// Cert_file is where the webhook server reads its certificate from.
+    pub cert_file: PathBuf,
+    /// Key_file is where the webhook server reads its key from.
+    pub key_file: PathBuf,
+}
+
+/// Run calls [`ensure`] periodically until `cancel` is cancelled, so certificates are rotated
+/// before they expire.
+pub async fn run(client: kube::Client, cfg: Config, cancel: CancellationToken) {
+    loop {
+        tokio::select! {
+            _ = cancel.cancelled() => return,
+            _ = tokio::time::sleep(CHECK_INTERVAL) => {},
+        };
+        if let Err(error) = ensure(&client, &cfg).await {
+            error!(%error, "unable to ensure webhook certificates");
+        }
+    }
+}
+
+/// Ensure makes sure a valid certificate exists in the configured Secret, that the webhook server's
+/// files match it, and that the webhook configurations trust its CA.
+#[instrument(skip_all, fields(secret = cfg.secret))]
+pub async fn ensure(client: &kube::Client, cfg: &Config) -> Result<()> {
+    let ns = client.default_namespace().to_string();
+    let api: Api<core::v1::Secret> = Api::default_namespaced(client.clone());
+
+    let mut data = None;
+    let mut conflict = None;
+    for _ in 0..2 {
+        let cur = api.get_opt(&cfg.secret).await?;
+        if let Some(d) = cur.as_ref().and_then(|s| s.data.as_ref()) {
+            if valid(d)? {
+                trace!("existing certificate OK");
+                data = Some(d.clone());
+                break;
+            }
+        }
+        info!("generating webhook certificate");
+        let dns = vec![
+            format!("{}.{ns}.svc", cfg.service),
+            format!("{}.{ns}.svc.{}", cfg.service, cfg.cluster_domain),
+        ];
+        let (ca, cert, key) = generate(&dns)?;
+        let mut d = BTreeMap::from([
+            ("ca.crt".to_string(), ByteString(ca)),
+            ("tls.crt".to_string(), ByteString(cert)),
+            ("tls.key".to_string(), ByteString(key)),
+        ]);
+        if let Some(prev) = cur
+            .as_ref()
+            .and_then(|s| s.data.as_ref())
+            .and_then(|d| d.get("ca.crt"))
+        {
+            d.insert(PREVIOUS_CA.into(), prev.clone());
+        }
+        let res = match cur {
+            Some(mut s) => {
+                s.data = Some(d.clone());
+                api.replace(&cfg.secret, &CREATE_PARAMS, &s).await
+            }
+            None => {
+                let s = core::v1::Secret {
+                    metadata: meta::v1::ObjectMeta {
+                        name: Some(cfg.secret.clone()),
+                        ..Default::default()
+                    },
+                    type_: Some("kubernetes.io/tls".into()),
+                    data: Some(d.clone()),
+                    ..Default::default()
+                };
+                api.create(&CREATE_PARAMS, &s).await
+            }
+        };
+        match res {
+            Ok(_) => {
+                data = Some(d);
+                break;
+            }
+            // Another replica got there first; use what it wrote.
+            Err(kube::Error::Api(err)) if err.code == 409 => {
+                conflict = Some(kube::Error::Api(err));
+                continue;
+            }
+            Err(err) => return Err(err.into()),
+        };
+    }
+    // Only conflicts leave the loop without data, so report the last one.
+    let data = match (data, conflict) {
+        (Some(data), _) => data,
+        (None, Some(err)) => return Err(err.into()),
+        (None, None) => unreachable!("certificate loop exited without data or error"),
+    };
+
+    write_if_changed(&cfg.cert_file, &data["tls.crt"].0).await?;
+    write_if_changed(&cfg.key_file, &data["tls.key"].0).await?;
+    inject_ca(client, &cfg.webhooks, &bundle(&data)?).await
+}
+
+/// Bundle returns the CA bundle the webhook configurations should trust for the Secret data: its
+/// CA, plus the CA it replaced if the rotation may not have reached every replica yet.
+fn bundle(data: &BTreeMap<String, ByteString>) -> Result<ByteString> {
+    let mut buf = data["ca.crt"].0.clone();
+    if let Some(prev) = data.get(PREVIOUS_CA) {
+        let cert = X509::from_pem(&data["tls.crt"].0)?;
+        let cutoff = Asn1Time::from_unix(Utc::now().timestamp() - ROTATION_GRACE.as_secs() as i64)?;
+        if cert.not_before() > cutoff {
+            buf.extend_from_slice(&prev.0);
+        }
+    }
+    Ok(ByteString(buf))
+}
+
+/// Valid reports whether the Secret data holds a complete certificate that isn't close to expiry.
+fn valid(data: &BTreeMap<String, ByteString>) -> Result<bool> {
+    if !["ca.crt", "tls.crt", "tls.key"]
+        .iter()
+        .all(|k| data.contains_key(*k))
+    {
+        return Ok(false);
+    }
+    let cert = X509::from_pem(&data["tls.crt"].0)?;
+    let renew = Asn1Time::days_from_now(RENEW_DAYS)?;
+    Ok(cert.not_after() > renew)
+}
+
+async fn write_if_changed(path: &Path, buf: &[u8]) -> Result<()> {
+    if tokio::fs::read(path).await.ok().as_deref() == Some(buf) {
+        return Ok(());
+    }
+    if let Some(dir) = path.parent() {
+        tokio::fs::create_dir_all(dir).await?;
+    }
+    tokio::fs::write(path, buf).await?;
+    debug!(path = %path.display(), "wrote certificate file");
+    Ok(())
+}
+
+/// Inject_ca sets the CA bundle of every webhook in the named configurations.
+async fn inject_ca(client: &kube::Client, names: &[String], ca: &ByteString) -> Result<()> {
+    let vapi: Api<ValidatingWebhookConfiguration> = Api::all(client.clone());
+    let mapi: Api<MutatingWebhookConfiguration> = Api::all(client.clone());
+    for name in names {
+        if let Some(mut v) = vapi.get_opt(name).await? {
+            let mut changed = false;
+            for w in v.webhooks.iter_mut().flatten() {
+                if w.client_config.ca_bundle.as_ref() != Some(ca) {
+                    w.client_config.ca_bundle = Some(ca.clone());
+                    changed = true;
+                }
+            }
+            if changed {
+                vapi.replace(name, &CREATE_PARAMS, &v).await?;
+                debug!(name, "injected CA bundle");
+            }
+        }
+        if let Some(mut m) = mapi.get_opt(name).await? {
+            let mut changed = false;
+            for w in m.webhooks.iter_mut().flatten() {
+                if w.client_config.ca_bundle.as_ref() != Some(ca) {
+                    w.client_config.ca_bundle = Some(ca.clone());
+                    changed = true;
+                }
+            }
+            if changed {
+                mapi.replace(name, &CREATE_PARAMS, &m).await?;
+                debug!(name, "injected CA bundle");
+            }
+        }
+    }
+    Ok(())
+}
+
+/// Generate creates a CA and a serving certificate for `dns` signed by it, returning the PEM
+/// encoded CA certificate, serving certificate, and PKCS#8 serving key.
+fn generate(dns: &[String]) -> Result<(Vec<u8>, Vec<u8>, Vec<u8>)> {
+    let not_before = Asn1Time::days_from_now(0)?;
+    let not_after = Asn1Time::days_from_now(VALID_DAYS)?;
+
+    let ca_key = new_key()?;
+    let mut name = X509NameBuilder::new()?;
+    name.append_entry_by_text("CN", "clair-operator-webhook-ca")?;
+    let name = name.build();
+    let sn = serial()?;
+    let mut b = X509::builder()?;
+    b.set_version(2)?;
+    b.set_serial_number(&sn)?;
+    b.set_subject_name(&name)?;
+    b.set_issuer_name(&name)?;
+    b.set_pubkey(&ca_key)?;
+    b.set_not_before(&not_before)?;
+    b.set_not_after(&not_after)?;
+    b.append_extension(BasicConstraints::new().critical().ca().build()?)?;
+    b.append_extension(
+        KeyUsage::new()
+            .critical()
+            .key_cert_sign()
+            .crl_sign()
+            .build()?,
+    )?;
+    b.sign(&ca_key, MessageDigest::sha256())?;
+    let ca = b.build();
+
+    let key = new_key()?;
+    let mut name = X509NameBuilder::new()?;
+    name.append_entry_by_text("CN", &dns[0])?;
+    let name = name.build();
+    let sn = serial()?;
+    let mut b = X509::builder()?;
+    b.set_version(2)?;
+    b.set_serial_number(&sn)?;
+    b.set_subject_name(&name)?;
+    b.set_issuer_name(ca.subject_name())?;
+    b.set_pubkey(&key)?;
+    b.set_not_before(&not_before)?;
+    b.set_not_after(&not_after)?;
+    let mut san = SubjectAlternativeName::new();
+    for d in dns {
+        san.dns(d);
+    }
+    let san = san.build(&b.x509v3_context(Some(&ca), None))?;
+    b.append_extension(san)?;
+    b.append_extension(
+        KeyUsage::new()
+            .critical()
+            .digital_signature()
+            .key_encipherment()
+            .build()?,
+    )?;
+    b.append_extension(ExtendedKeyUsage::new().server_auth().build()?)?;
+    b.sign(&ca_key, MessageDigest::sha256())?;
+    let cert = b.build();
+
+    Ok((
+        ca.to_pem()?,
+        cert.to_pem()?,
+        key.private_key_to_pem_pkcs8()?,
+    ))
+}
+
+fn new_key() -> Result<PKey<Private>> {
+    Ok(PKey::from_rsa(Rsa::generate(2048)?)?)
+}
+
+fn serial() -> Result<Asn1Integer> {
+    let mut bn = BigNum::new()?;
+    bn.rand(159, MsbOption::MAYBE_ZERO, false)?;
+    Ok(bn.to_asn1_integer()?)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn generate_valid() {
+        let dns = vec!["webhook.ns.svc".to_string()];
+        let (ca, cert, key) = generate(&dns).expect("generate failed");
+        let data = BTreeMap::from([
+            ("ca.crt".to_string(), ByteString(ca)),
+            ("tls.crt".to_string(), ByteString(cert)),
+            ("tls.key".to_string(), ByteString(key)),
+        ]);
+        assert!(valid(&data).expect("validation failed"));
+    }
+
+    #[test]
+    fn bundle_keeps_previous_ca() {
+        let dns = vec!["webhook.ns.svc".to_string()];
+        let (prev, _, _) = generate(&dns).expect("generate failed");
+        let (ca, cert, key) = generate(&dns).expect("generate failed");
+        let mut data = BTreeMap::from([
+            ("ca.crt".to_string(), ByteString(ca.clone())),
+            ("tls.crt".to_string(), ByteString(cert)),
+            ("tls.key".to_string(), ByteString(key)),
+        ]);
+        assert_eq!(bundle(&data).expect("bundle failed").0, ca);
+
+        data.insert(PREVIOUS_CA.into(), ByteString(prev.clone()));
+        let got = bundle(&data).expect("bundle failed").0;
+        assert_eq!(got, [ca, prev].concat());
+        assert_eq!(X509::stack_from_pem(&got).expect("bad bundle").len(), 2);
+    }
+}
@@ -9,10 +9,7 @@ use kube::{
     core::{GroupVersionKind, ObjectMeta},
     discovery::oneshot,
 };
-use tokio::{
-    signal::unix::{signal, SignalKind},
-    time::Duration,
-};
+use tokio::signal::unix::{signal, SignalKind};
 use tokio_stream::wrappers::SignalStream;
 
 use crate::{
@@ -62,39 +59,46 @@ pub fn controller(cancel: CancellationToken, ctx: Arc<Context>) -> Result<Contro
             Api::<networking::v1::Ingress>::default_namespaced(client),
             ctlcfg,
         )
+        .with_config(ctx.tuning.controller_config())
         .reconcile_all_on(sig)
         .graceful_shutdown_on(cancel.cancelled_owned());
 
+    let limit = ctx.tuning.limiter();
+
     Ok(async move {
         info!("starting clair controller");
-        ctl.run(reconcile, error_policy, ctx)
-            .for_each(|ret| {
-                match ret {
-                    Ok(_) => (),
-                    Err(err) => match err {
-                        CtrlErr::ObjectNotFound(objref) => error!(%objref, "object not found"),
-                        CtrlErr::ReconcilerFailed(error, objref) => {
-                            error!(%objref, %error, "reconcile error")
-                        }
-                        CtrlErr::QueueError(error) => error!(%error, "queue error"),
-                        CtrlErr::RunnerError(error) => error!(%error, "runner error"),
-                    },
-                };
-                futures::future::ready(())
-            })
-            .await;
+        ctl.run(
+            |obj, ctx| limited(limit.clone(), measure(COMPONENT, reconcile(obj, ctx))),
+            error_policy,
+            ctx,
+        )
+        .for_each(|ret| {
+            match ret {
+                Ok(_) => (),
+                Err(err) => match err {
+                    CtrlErr::ObjectNotFound(objref) => error!(%objref, "object not found"),
+                    CtrlErr::ReconcilerFailed(error, objref) => {
+                        error!(%objref, %error, "reconcile error")
+                    }
+                    CtrlErr::QueueError(error) => error!(%error, "queue error"),
+                    CtrlErr::RunnerError(error) => error!(%error, "runner error"),
+                },
+            };
+            futures::future::ready(())
+        })
+        .await;
         debug!("clair controller finished");
         Ok(())
     }
     .boxed())
 }
 
-fn error_policy(obj: Arc<v1alpha1::Clair>, err: &Error, _ctx: Arc<Context>) -> Action {
+fn error_policy(obj: Arc<v1alpha1::Clair>, err: &Error, ctx: Arc<Context>) -> Action {
     error!(
         error = err.to_string(),
         obj.metadata.name, obj.metadata.uid, "reconcile error"
     );
-    Action::requeue(Duration::from_secs(1))
+    Action::requeue(ctx.backoff.failed(obj.as_ref(), &ctx.tuning))
 }
 
 #[instrument(skip_all)]
@@ -120,7 +124,7 @@ async fn reconcile(obj: Arc<v1alpha1::Clair>, ctx: Arc<Context>) -> Result<Actio
             reason: "SpecIncomplete".into(),
             note: Some("\"/spec/databases\" must be populated".into()),
         })
-        .await?;
+        .await;
         next.add_condition(Condition {
             last_transition_time: req.now(),
             observed_generation: obj.metadata.generation,
@@ -140,7 +144,7 @@ async fn reconcile(obj: Arc<v1alpha1::Clair>, ctx: Arc<Context>) -> Result<Actio
             reason: "SpecIncomplete".into(),
             note: Some("\"/spec/databases/notifier\" must be populated".into()),
         })
-        .await?;
+        .await;
         next.add_condition(Condition {
             last_transition_time: req.now(),
             observed_generation: obj.metadata.generation,
@@ -192,6 +196,8 @@ $(
         check_indexer,
         check_matcher,
         check_notifier,
+        check_dns,
+        check_available,
     );
 
     publish(obj, ctx, req, next).await
@@ -228,16 +234,19 @@ async fn publish(
 
     if let Some(cur) = cur {
         debug!(attempt = ct, prev, cur, "published status");
+        ctx.backoff.succeeded(obj.as_ref());
         if cur == prev {
             // If there was no change, queue out in the future.
-            Ok(Action::requeue(Duration::from_secs(3600)))
+            Ok(Action::requeue(ctx.tuning.resync))
         } else {
             // Handled, so discard the event.
             Ok(Action::await_change())
         }
     } else {
         // Unable to update, so requeue soon.
-        Ok(Action::requeue(Duration::from_secs(5)))
+        Ok(Action::requeue(
+            ctx.backoff.failed(obj.as_ref(), &ctx.tuning),
+        ))
     }
 }
 
@@ -277,28 +286,26 @@ async fn initialize_endpoint(
             let ingress = api.create(&params, &ingress).await;
             match ingress {
                 Ok(v) => {
-                    let _ = req
-                        .publish(Event {
-                            type_: EventType::Warning,
-                            reason: "Success".into(),
-                            note: None,
-                            action,
-                            secondary: Some(v.object_ref(&())),
-                        })
-                        .await;
+                    req.publish(Event {
+                        type_: EventType::Warning,
+                        reason: "Success".into(),
+                        note: None,
+                        action,
+                        secondary: Some(v.object_ref(&())),
+                    })
+                    .await;
                     debug!(name = v.name_any(), "ingress created");
                     Ok(v.name_any())
                 }
                 Err(e) => {
-                    let _ = req
-                        .publish(Event {
-                            type_: EventType::Warning,
-                            reason: "Failed".into(),
-                            note: Some(e.to_string()),
-                            action,
-                            secondary: None,
-                        })
-                        .await;
+                    req.publish(Event {
+                        type_: EventType::Warning,
+                        reason: "Failed".into(),
+                        note: Some(e.to_string()),
+                        action,
+                        secondary: None,
+                    })
+                    .await;
                     error!(error = ?e, "ingress creation failure");
                     Err(e)
                 }
@@ -334,6 +341,7 @@ async fn new_ingress(
     v.metadata.owner_references = Some(vec![oref]);
     v.metadata.name = Some(obj.name_any());
     crate::set_component_label(v.meta_mut(), COMPONENT);
+    apply_external_dns(v.annotations_mut(), obj.spec.endpoint.as_ref());
     let spec = v.spec.as_mut().expect("bad Ingress from template");
     // Attach TLS config if provided.
     if let Some(ref endpoint) = obj.spec.endpoint {
@@ -392,6 +400,37 @@ async fn new_ingress(
     Ok(v)
 }
 
+/// EXTERNAL_DNS_ANNOTATIONS are the external-dns annotations managed from an Endpoint.
+static EXTERNAL_DNS_ANNOTATIONS: [&str; 2] = [
+    "external-dns.alpha.kubernetes.io/hostname",
+    "external-dns.alpha.kubernetes.io/ttl",
+];
+
+/// External_dns_annotations returns the external-dns annotations requested by the Endpoint, if
+/// any.
+fn external_dns_annotations(endpoint: Option<&v1alpha1::Endpoint>) -> BTreeMap<String, String> {
+    let mut out = BTreeMap::new();
+    if let Some(endpoint) = endpoint {
+        if let (Some(dns), Some(hostname)) = (&endpoint.external_dns, &endpoint.hostname) {
+            out.insert(EXTERNAL_DNS_ANNOTATIONS[0].into(), hostname.clone());
+            if let Some(ttl) = dns.ttl.filter(|ttl| *ttl > 0) {
+                out.insert(EXTERNAL_DNS_ANNOTATIONS[1].into(), ttl.to_string());
+            }
+        }
+    }
+    out
+}
+
+/// Apply_external_dns sets the external-dns annotations requested by the Endpoint in
+/// `annotations`, removing any that are no longer requested.
+fn apply_external_dns(
+    annotations: &mut BTreeMap<String, String>,
+    endpoint: Option<&v1alpha1::Endpoint>,
+) {
+    annotations.retain(|k, _| !EXTERNAL_DNS_ANNOTATIONS.contains(&k.as_str()));
+    annotations.extend(external_dns_annotations(endpoint));
+}
+
 #[instrument(skip_all)]
 async fn check_config(
     obj: &v1alpha1::Clair,
@@ -440,6 +479,11 @@ async fn check_config(
             if let Some(ref mut ev) = &mut ev {
                 ev.secondary = Some(cm.object_ref(&()));
             };
+            apply_common_metadata(
+                cm,
+                spec.common_labels.as_ref(),
+                spec.common_annotations.as_ref(),
+            );
             let data = cm.data.get_or_insert_with(BTreeMap::default);
             let key = match flavor {
                 v1alpha1::ConfigDialect::JSON => "config.json".into(),
@@ -464,7 +508,7 @@ async fn check_config(
             dropins: vec![],
         });
         if let Some(ev) = ev {
-            req.publish(ev).await?;
+            req.publish(ev).await;
         };
     } else if let Some(cfg) = next.config.as_mut() {
         cfg.root.name = name;
@@ -548,7 +592,6 @@ async fn check_subs(
     let p: clair_config::Parts = load_clair_config(&ctx.client, &config).await?;
     let v = p.validate().await?;
     let action = String::from("ConfigValidation");
-    let reason = String::from("ConfigAdded");
     let message = String::from("🆗");
     for (sub, res) in [
         (
@@ -606,15 +649,20 @@ async fn check_subs(
                     status: "False".to_string(),
                     type_,
                 });
-                let _ = req
-                    .publish(Event {
-                        type_: EventType::Warning,
-                        reason: reason.clone(),
-                        note: Some(err.to_string()),
-                        action: action.clone(),
-                        secondary: None, // TODO(hank) Reference the subresource.
-                    })
-                    .await;
+                req.publish(Event {
+                    type_: EventType::Warning,
+                    reason: format!("{}ValidationFailure", sub.kind),
+                    note: Some(err.to_string()),
+                    action: action.clone(),
+                    secondary: Some(core::v1::ObjectReference {
+                        api_version: Some(format!("{}/{}", gv.group, gv.version)),
+                        kind: Some(sub.kind.clone()),
+                        name: Some(sub.name.clone()),
+                        namespace: obj.namespace(),
+                        ..Default::default()
+                    }),
+                })
+                .await;
                 info!(
                     kind = sub.kind,
                     name = sub.name,
@@ -730,6 +778,12 @@ async fn check_ingress(
                 futures::executor::block_on(new_ingress(obj, ctx, req)).expect("template failed")
             })
             .and_modify(|ing| {
+                apply_common_metadata(
+                    ing,
+                    obj.spec.common_labels.as_ref(),
+                    obj.spec.common_annotations.as_ref(),
+                );
+                apply_external_dns(ing.annotations_mut(), spec.endpoint.as_ref());
                 let tgt = ing.spec.as_mut().expect("invalid IngressSpec");
                 if let Some(rules) = &tgt.rules {
                     if rules.len() != 1 {
@@ -807,6 +861,7 @@ async fn check_indexer(
 ) -> Result<bool> {
     let api = Api::<v1alpha1::Indexer>::default_namespaced(ctx.client.clone());
     let name = obj.name_any();
+    let want = target_image(obj, ctx, next);
 
     let mut ct = 0;
     while ct < 3 {
@@ -826,8 +881,17 @@ async fn check_indexer(
                 idx
             })
             .and_modify(|idx| {
-                idx.spec.image = Some(ctx.image.clone());
+                idx.spec.image = Some(want.clone());
                 idx.spec.config = next.config.clone();
+                idx.spec.hibernate = obj.spec.hibernate;
+                idx.spec.common_labels = obj.spec.common_labels.clone();
+                idx.spec.common_annotations = obj.spec.common_annotations.clone();
+                idx.spec.service_mesh = obj.spec.service_mesh;
+                apply_common_metadata(
+                    idx,
+                    obj.spec.common_labels.as_ref(),
+                    obj.spec.common_annotations.as_ref(),
+                );
             });
         next.indexer = {
             let idx = entry.get();
@@ -856,11 +920,54 @@ async fn check_indexer(
 async fn check_matcher(
     obj: &v1alpha1::Clair,
     ctx: &Context,
-    _req: &Request,
+    req: &Request,
     next: &mut v1alpha1::ClairStatus,
 ) -> Result<bool> {
     let api = Api::<v1alpha1::Matcher>::default_namespaced(ctx.client.clone());
     let name = obj.name_any();
+    let mut want = target_image(obj, ctx, next);
+    let ready = match Api::<v1alpha1::Indexer>::default_namespaced(ctx.client.clone())
+        .get_opt(&name)
+        .await?
+    {
+        Some(o) => {
+            let status = o.status.unwrap_or_default();
+            rolled_out(ctx, &o.spec.image, &status.refs, &status.conditions, &want).await?
+        }
+        None => false,
+    };
+    // If the Matcher can't become available on the new image, every component goes back to the
+    // last image that rolled out. Otherwise, once it has rolled out, that's the new fallback.
+    let mut rollback = false;
+    if let Some(o) = api.get_opt(&name).await? {
+        let status = o.status.unwrap_or_default();
+        if o.spec.image.as_deref() == Some(want.as_str()) && degraded(&status.conditions) {
+            if let Some(prev) = next.image.clone().filter(|prev| *prev != want) {
+                warn!(
+                    image = want,
+                    previous = prev,
+                    "matcher rollout failed, rolling back"
+                );
+                req.publish(Event {
+                    type_: EventType::Warning,
+                    reason: "RolledBack".into(),
+                    note: Some(format!(
+                        "Matcher failed to roll out {want:?}, rolling back to {prev:?}"
+                    )),
+                    action: "CheckRollout".into(),
+                    secondary: None,
+                })
+                .await;
+                next.failed_image = Some(want);
+                want = prev;
+                rollback = true;
+            }
+        } else if ready
+            && rolled_out(ctx, &o.spec.image, &status.refs, &status.conditions, &want).await?
+        {
+            next.image = Some(want.clone());
+        }
+    }
 
     let mut ct = 0;
     while ct < 3 {
@@ -880,9 +987,30 @@ async fn check_matcher(
                 idx
             })
             .and_modify(|idx| {
-                idx.spec.image = Some(ctx.image.clone());
+                // A new Matcher can start on the wanted image, but an existing one waits for the
+                // Indexer to finish rolling out first. Rolling back doesn't wait.
+                if idx.spec.image.is_none() || ready || rollback {
+                    idx.spec.image = Some(want.clone());
+                }
                 idx.spec.config = next.config.clone();
+                idx.spec.hibernate = obj.spec.hibernate;
+                idx.spec.common_labels = obj.spec.common_labels.clone();
+                idx.spec.common_annotations = obj.spec.common_annotations.clone();
+                idx.spec.service_mesh = obj.spec.service_mesh;
+                apply_common_metadata(
+                    idx,
+                    obj.spec.common_labels.as_ref(),
+                    obj.spec.common_annotations.as_ref(),
+                );
             });
+        next.add_condition(image_condition(
+            obj,
+            req,
+            &v1alpha1::Matcher::kind(&()),
+            &entry.get().spec.image,
+            &want,
+            "Indexer",
+        ));
         next.matcher = {
             let idx = entry.get();
             Some(TypedLocalObjectReference {
@@ -910,7 +1038,7 @@ async fn check_matcher(
 async fn check_notifier(
     obj: &v1alpha1::Clair,
     ctx: &Context,
-    _req: &Request,
+    req: &Request,
     next: &mut v1alpha1::ClairStatus,
 ) -> Result<bool> {
     if !obj.spec.notifier.unwrap_or(false) {
@@ -919,6 +1047,17 @@ async fn check_notifier(
     }
     let api = Api::<v1alpha1::Notifier>::default_namespaced(ctx.client.clone());
     let name = obj.name_any();
+    let want = target_image(obj, ctx, next);
+    let ready = match Api::<v1alpha1::Matcher>::default_namespaced(ctx.client.clone())
+        .get_opt(&name)
+        .await?
+    {
+        Some(o) => {
+            let status = o.status.unwrap_or_default();
+            rolled_out(ctx, &o.spec.image, &status.refs, &status.conditions, &want).await?
+        }
+        None => false,
+    };
 
     let mut ct = 0;
     while ct < 3 {
@@ -938,9 +1077,26 @@ async fn check_notifier(
                 idx
             })
             .and_modify(|idx| {
-                idx.spec.image = Some(ctx.image.clone());
+                // A new Notifier can start on the wanted image, but an existing one waits for the
+                // Matcher to finish rolling out first.
+                if idx.spec.image.is_none() || ready {
+                    idx.spec.image = Some(want.clone());
+                }
                 idx.spec.config = next.config.clone();
+                apply_common_metadata(
+                    idx,
+                    obj.spec.common_labels.as_ref(),
+                    obj.spec.common_annotations.as_ref(),
+                );
             });
+        next.add_condition(image_condition(
+            obj,
+            req,
+            &v1alpha1::Notifier::kind(&()),
+            &entry.get().spec.image,
+            &want,
+            "Matcher",
+        ));
         next.notifier = {
             let idx = entry.get();
             Some(TypedLocalObjectReference {
@@ -962,4 +1118,275 @@ async fn check_notifier(
     }
     debug!("notifier up-to-date");
     Ok(true)
-}
\ No newline at end of file
+}
+
+/// Target_image returns the image the components should run: the requested image, unless rolling
+/// it out failed, in which case the image that last rolled out.
+fn target_image(obj: &v1alpha1::Clair, ctx: &Context, next: &mut v1alpha1::ClairStatus) -> String {
+    let want = obj.spec.image_default(&ctx.image);
+    if next.failed_image.as_ref().is_some_and(|f| *f != want) {
+        next.failed_image = None;
+    }
+    match (&next.failed_image, &next.image) {
+        (Some(_), Some(prev)) => prev.clone(),
+        _ => want,
+    }
+}
+
+/// Degraded reports whether `cnds` has a true "projectclair.io/Degraded" condition.
+fn degraded(cnds: &[Condition]) -> bool {
+    let type_ = clair_condition("Degraded");
+    cnds.iter().any(|c| c.type_ == type_ && c.status == "True")
+}
+
+/// Rolled_out reports whether a component has finished rolling out the image `want`.
+///
+/// The component must have been asked for `want`, not be degraded, and have its Deployment, found
+/// in `refs`, fully rolled out to `want`.
+async fn rolled_out(
+    ctx: &Context,
+    spec_image: &Option<String>,
+    refs: &[TypedLocalObjectReference],
+    cnds: &[Condition],
+    want: &str,
+) -> Result<bool> {
+    if spec_image.as_deref() != Some(want) || degraded(cnds) {
+        return Ok(false);
+    }
+    let kind = apps::v1::Deployment::kind(&());
+    let name = match refs.iter().find(|r| r.kind == kind) {
+        Some(r) => &r.name,
+        None => return Ok(false),
+    };
+    Ok(
+        match Api::<apps::v1::Deployment>::default_namespaced(ctx.client.clone())
+            .get_opt(name)
+            .await?
+        {
+            Some(d) => deployment_rolled_out(&d, want),
+            None => false,
+        },
+    )
+}
+
+/// Deployment_rolled_out reports whether every desired replica of `d` runs `want` and is
+/// available, with no replicas of an older template left.
+fn deployment_rolled_out(d: &apps::v1::Deployment, want: &str) -> bool {
+    let (spec, status) = match (&d.spec, &d.status) {
+        (Some(spec), Some(status)) => (spec, status),
+        _ => return false,
+    };
+    let image = spec
+        .template
+        .spec
+        .as_ref()
+        .and_then(|s| s.containers.iter().find(|c| c.name == "clair"))
+        .and_then(|c| c.image.as_deref());
+    let desired = spec.replicas.unwrap_or(1);
+    image == Some(want)
+        && status.observed_generation >= d.metadata.generation
+        && status.updated_replicas.unwrap_or_default() == desired
+        && status.available_replicas.unwrap_or_default() == desired
+        && status.replicas.unwrap_or_default() == desired
+}
+
+/// Image_condition reports whether the component `kind` has been moved to the image `want`, or is
+/// waiting on the component named by `after`.
+fn image_condition(
+    obj: &v1alpha1::Clair,
+    req: &Request,
+    kind: &str,
+    image: &Option<String>,
+    want: &str,
+    after: &str,
+) -> Condition {
+    let current = image.as_deref() == Some(want);
+    Condition {
+        last_transition_time: req.now(),
+        observed_generation: obj.metadata.generation,
+        type_: clair_condition(format!("{kind}ImageCurrent")),
+        status: if current { "True" } else { "False" }.into(),
+        reason: if current {
+            "ImageCurrent".into()
+        } else {
+            format!("WaitingOn{after}")
+        },
+        message: if current {
+            String::new()
+        } else {
+            format!("waiting for the {after} to roll out {want:?}")
+        },
+    }
+}
+
+/// Check_dns removes external-dns annotations from the Indexer's and Matcher's Services.
+///
+/// Only the Ingress exposes the Endpoint, so it's the only object that carries them. Anything
+/// else claiming the same hostname would produce conflicting records in clusters where
+/// external-dns publishes internal Services.
+#[instrument(skip_all)]
+async fn check_dns(
+    obj: &v1alpha1::Clair,
+    ctx: &Context,
+    _req: &Request,
+    _next: &mut v1alpha1::ClairStatus,
+) -> Result<bool> {
+    use self::core::v1::Service;
+
+    let name = obj.name_any();
+    let services = [
+        Api::<v1alpha1::Indexer>::default_namespaced(ctx.client.clone())
+            .get_opt(&name)
+            .await?
+            .and_then(|o| o.status)
+            .and_then(|s| s.has_ref::<Service>()),
+        Api::<v1alpha1::Matcher>::default_namespaced(ctx.client.clone())
+            .get_opt(&name)
+            .await?
+            .and_then(|o| o.status)
+            .and_then(|s| s.has_ref::<Service>()),
+    ];
+    let api = Api::<Service>::default_namespaced(ctx.client.clone());
+    for sref in services.into_iter().flatten() {
+        let srv = match api.get_opt(&sref.name).await? {
+            Some(srv) => srv,
+            None => continue,
+        };
+        if !EXTERNAL_DNS_ANNOTATIONS
+            .iter()
+            .any(|k| srv.annotations().contains_key(*k))
+        {
+            continue;
+        }
+        // A merge patch removes keys set to null.
+        let patch: BTreeMap<&str, Option<()>> = EXTERNAL_DNS_ANNOTATIONS
+            .iter()
+            .map(|k| (*k, None))
+            .collect();
+        trace!(name = sref.name, "removing external-dns annotations");
+        api.patch(
+            &sref.name,
+            &PATCH_PARAMS,
+            &Patch::Merge(serde_json::json!({ "metadata": { "annotations": patch } })),
+        )
+        .await?;
+    }
+    Ok(true)
+}
+
+/// Check_available rolls the conditions of the Indexer, Matcher, and Notifier up into "Ready",
+/// "Progressing", and "Degraded" conditions on the Clair.
+///
+/// These condition types are deliberately not in the controller's space, so that generic tooling
+/// (kstatus, Argo CD health checks) recognizes them.
+#[instrument(skip_all)]
+async fn check_available(
+    obj: &v1alpha1::Clair,
+    ctx: &Context,
+    req: &Request,
+    next: &mut v1alpha1::ClairStatus,
+) -> Result<bool> {
+    let name = obj.name_any();
+    let mut children = vec![
+        (
+            v1alpha1::Indexer::kind(&()),
+            Api::<v1alpha1::Indexer>::default_namespaced(ctx.client.clone())
+                .get_opt(&name)
+                .await?
+                .map(|o| o.status.unwrap_or_default().conditions),
+        ),
+        (
+            v1alpha1::Matcher::kind(&()),
+            Api::<v1alpha1::Matcher>::default_namespaced(ctx.client.clone())
+                .get_opt(&name)
+                .await?
+                .map(|o| o.status.unwrap_or_default().conditions),
+        ),
+    ];
+    if obj.spec.notifier.unwrap_or(false) {
+        children.push((
+            v1alpha1::Notifier::kind(&()),
+            Api::<v1alpha1::Notifier>::default_namespaced(ctx.client.clone())
+                .get_opt(&name)
+                .await?
+                .map(|o| o.status.unwrap_or_default().conditions),
+        ));
+    }
+
+    let initialized = clair_condition("Initialized");
+    let spec_ok = clair_condition("SpecOK");
+    let rollout_stuck = clair_condition("Degraded");
+    let mut pending: Vec<&str> = Vec::new();
+    let mut degraded: Vec<&str> = Vec::new();
+    for (kind, cnds) in children.iter() {
+        let cnds = cnds.as_deref().unwrap_or_default();
+        let is =
+            |type_: &str, status: &str| cnds.iter().any(|c| c.type_ == type_ && c.status == status);
+        if is(&spec_ok, "False") || is(&rollout_stuck, "True") {
+            degraded.push(kind.as_ref());
+        } else if !is(&initialized, "True") {
+            pending.push(kind.as_ref());
+        }
+    }
+    trace!(?pending, ?degraded, "component states");
+
+    let available = pending.is_empty() && degraded.is_empty();
+    let mut unavailable = pending.clone();
+    unavailable.extend(degraded.iter());
+    let condition = |type_: &str, ok: bool, reason: &str, message: String| Condition {
+        last_transition_time: req.now(),
+        observed_generation: obj.metadata.generation,
+        type_: type_.into(),
+        status: if ok { "True" } else { "False" }.into(),
+        reason: reason.into(),
+        message,
+    };
+    let ready = if available {
+        condition("Ready", true, "ComponentsAvailable", String::new())
+    } else {
+        condition(
+            "Ready",
+            false,
+            "ComponentsUnavailable",
+            format!("unavailable: {}", unavailable.join(", ")),
+        )
+    };
+    let ev = Event {
+        type_: if available {
+            EventType::Normal
+        } else {
+            EventType::Warning
+        },
+        reason: ready.reason.clone(),
+        note: Some(if available {
+            "all components available".into()
+        } else {
+            ready.message.clone()
+        }),
+        action: "CheckAvailable".into(),
+        secondary: None,
+    };
+    req.transitioned(&next.conditions, &ready, ev).await;
+    next.add_condition(ready);
+    next.add_condition(if pending.is_empty() {
+        condition("Progressing", false, "ComponentsSettled", String::new())
+    } else {
+        condition(
+            "Progressing",
+            true,
+            "ComponentsPending",
+            format!("waiting on: {}", pending.join(", ")),
+        )
+    });
+    next.add_condition(if degraded.is_empty() {
+        condition("Degraded", false, "ComponentsHealthy", String::new())
+    } else {
+        condition(
+            "Degraded",
+            true,
+            "ComponentsFailing",
+            format!("failing: {}", degraded.join(", ")),
+        )
+    });
+    Ok(true)
+}
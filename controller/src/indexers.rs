@@ -11,11 +11,12 @@ use kube::{runtime::controller::Error as CtrlErr, Api};
 use tokio::{
     runtime::Handle,
     signal::unix::{signal, SignalKind},
-    time::Duration,
 };
 use tokio_stream::wrappers::SignalStream;
 
-use crate::{clair_condition, prelude::*, COMPONENT_LABEL};
+use crate::{
+    clair_condition, prelude::*, COMPONENT_LABEL, CONFIG_DIGEST_ANNOTATION, ROLLBACK_ANNOTATION,
+};
 
 static COMPONENT: &str = "indexer";
 
@@ -44,28 +45,38 @@ pub fn controller(cancel: CancellationToken, ctx: Arc<Context>) -> Result<Contro
         Api::<autoscaling::v2::HorizontalPodAutoscaler>::default_namespaced(client.clone()),
         ctlcfg.clone(),
     )
-    .owns(Api::<core::v1::Service>::default_namespaced(client), ctlcfg)
-    .reconcile_all_on(sig)
-    .graceful_shutdown_on(cancel.cancelled_owned());
+    .owns(Api::<core::v1::Service>::default_namespaced(client), ctlcfg);
+    let ctl = watch_configs(ctl, &ctx, |obj| obj.spec.config.as_ref());
+    let ctl = watch_deployments(ctl, &ctx, |obj| obj.spec.deployment.as_ref());
+    let ctl = watch_proxy(ctl, &ctx)
+        .with_config(ctx.tuning.controller_config())
+        .reconcile_all_on(sig)
+        .graceful_shutdown_on(cancel.cancelled_owned());
+
+    let limit = ctx.tuning.limiter();
 
     Ok(async move {
         info!("spawning indexer controller");
-        ctl.run(reconcile, handle_error, ctx)
-            .for_each(|ret| {
-                match ret {
-                    Ok(_) => (),
-                    Err(err) => match err {
-                        CtrlErr::ObjectNotFound(objref) => error!(%objref, "object not found"),
-                        CtrlErr::ReconcilerFailed(error, objref) => {
-                            error!(%objref, %error, "reconcile error")
-                        }
-                        CtrlErr::QueueError(error) => error!(%error, "queue error"),
-                        CtrlErr::RunnerError(error) => error!(%error, "runner error"),
-                    },
-                };
-                futures::future::ready(())
-            })
-            .await;
+        ctl.run(
+            |obj, ctx| limited(limit.clone(), measure(COMPONENT, reconcile(obj, ctx))),
+            handle_error,
+            ctx,
+        )
+        .for_each(|ret| {
+            match ret {
+                Ok(_) => (),
+                Err(err) => match err {
+                    CtrlErr::ObjectNotFound(objref) => error!(%objref, "object not found"),
+                    CtrlErr::ReconcilerFailed(error, objref) => {
+                        error!(%objref, %error, "reconcile error")
+                    }
+                    CtrlErr::QueueError(error) => error!(%error, "queue error"),
+                    CtrlErr::RunnerError(error) => error!(%error, "runner error"),
+                },
+            };
+            futures::future::ready(())
+        })
+        .await;
         debug!("indexer controller finished");
         Ok(())
     }
@@ -94,7 +105,7 @@ async fn reconcile(obj: Arc<v1alpha1::Indexer>, ctx: Arc<Context>) -> Result<Act
             action,
             secondary: None,
         })
-        .await?;
+        .await;
         next.add_condition(meta::v1::Condition {
             last_transition_time: req.now(),
             message: "\"/spec/config\" missing".into(),
@@ -108,7 +119,7 @@ async fn reconcile(obj: Arc<v1alpha1::Indexer>, ctx: Arc<Context>) -> Result<Act
     debug!("configsource ok");
     debug!(
         provided = spec.image.is_some(),
-        image = spec.image_default(&crate::DEFAULT_IMAGE),
+        image = spec.image_default(&ctx.image),
         "image check"
     );
     next.add_condition(Condition {
@@ -143,6 +154,7 @@ $(
         check_deployment,
         check_service,
         check_hpa,
+        check_vpa,
         check_creation
     );
 
@@ -164,9 +176,9 @@ async fn publish(
     let mut cur = None;
     let mut c = v1alpha1::Indexer::new(&name, Default::default());
     c.status = Some(next);
+    c.metadata.resource_version = obj.metadata.resource_version.clone();
     let mut ct = 0;
     while ct < 3 {
-        c.metadata.resource_version = obj.metadata.resource_version.clone();
         ct += 1;
         let buf = serde_json::to_vec(&c)?;
         match api.replace_status(&name, &CREATE_PARAMS, buf).await {
@@ -174,22 +186,32 @@ async fn publish(
                 cur = c.resource_version();
                 break;
             }
+            // Something else wrote the object since it was read. The status is computed entirely
+            // by this reconcile, so it's written over the newer version rather than discarding
+            // the work done so far.
+            Err(kube::Error::Api(err)) if err.code == 409 => {
+                debug!(attempt = ct, "status conflict, retrying");
+                c.metadata.resource_version = api.get_status(&name).await?.resource_version();
+            }
             Err(err) => error!(error=%err, "problem updating status"),
         }
     }
 
     if let Some(cur) = cur {
         debug!(attempt = ct, prev, cur, "published status");
+        ctx.backoff.succeeded(obj.as_ref());
         if cur == prev {
             // If there was no change, queue out in the future.
-            Ok(Action::requeue(Duration::from_secs(3600)))
+            Ok(Action::requeue(ctx.tuning.resync))
         } else {
             // Handled, so discard the event.
             Ok(Action::await_change())
         }
     } else {
         // Unable to update, so requeue soon.
-        Ok(Action::requeue(Duration::from_secs(5)))
+        Ok(Action::requeue(
+            ctx.backoff.failed(obj.as_ref(), &ctx.tuning),
+        ))
     }
 }
 
@@ -265,11 +287,16 @@ async fn check_dropin(
             cm
         });
         let cm = entry.get_mut();
+        apply_common_metadata(
+            cm,
+            obj.spec.common_labels.as_ref(),
+            obj.spec.common_annotations.as_ref(),
+        );
         if let Some(k) = cm.annotations().get(crate::DROPIN_LABEL.as_str()) {
             if let Some(data) = cm.data.as_ref() {
                 if !data.contains_key(k) {
                     trace!(name = cm.name_any(), "ConfigMap missing key");
-                    let _ = futures::executor::block_on(_req.publish(Event {
+                    futures::executor::block_on(_req.publish(Event {
                         action: "ReconcileConfig".into(),
                         reason: "Reconcile".into(),
                         note: Some(format!("missing expected key: {k}")),
@@ -368,7 +395,7 @@ async fn check_config(
 async fn check_deployment(
     obj: &v1alpha1::Indexer,
     ctx: &Context,
-    _req: &Request,
+    req: &Request,
     next: &mut v1alpha1::IndexerStatus,
 ) -> Result<bool> {
     use self::core::v1::EnvVar;
@@ -393,23 +420,119 @@ async fn check_deployment(
         .ok_or(Error::BadName("missing needed spec field: config".into()))?;
     trace!("have configsource");
     let api = Api::<apps::v1::Deployment>::default_namespaced(ctx.client.clone());
-    let want_image = obj.spec.image_default(&crate::DEFAULT_IMAGE);
+    let want_image = obj.spec.image_default(&ctx.image);
+    let digest = config_digest(&ctx.client, cfgsrc).await?;
+    trace!(digest, "config digest");
+    if let Some(name) = &obj.spec.deployment {
+        // Switching to an existing Deployment leaves the templated one behind, so remove it.
+        let templated = obj
+            .status
+            .as_ref()
+            .and_then(|s| s.has_ref::<apps::v1::Deployment>())
+            .filter(|r| &r.name != name);
+        if let Some(r) = templated {
+            release_owned::<_, apps::v1::Deployment>(obj, ctx, &r.name).await?;
+            next.remove_ref::<apps::v1::Deployment>();
+        }
+        let d = match existing_deployment(ctx, name, &digest).await? {
+            Some(d) => d,
+            None => {
+                warn!(name, "Deployment not found");
+                return Ok(false);
+            }
+        };
+        let image = d
+            .spec
+            .as_ref()
+            .and_then(|s| s.template.spec.as_ref())
+            .and_then(|s| s.containers.iter().find(|c| c.name == "clair"))
+            .and_then(|c| c.image.clone())
+            .unwrap_or(want_image);
+        next.add_ref(&d);
+        let cnd = rollout_condition(obj, req, &d);
+        req.transitioned(&next.conditions, &cnd, rollout_event(&cnd))
+            .await;
+        next.add_condition(cnd);
+        next.image = resolved_image(ctx, &d, &image).await?;
+        return Ok(true);
+    }
+    let rollback = obj.annotations().get(ROLLBACK_ANNOTATION.as_str()).cloned();
+    if let Some(keep) = obj.spec.config_history.filter(|n| *n > 0) {
+        snapshot_config(obj, ctx, cfgsrc, &digest, keep.into(), rollback.as_deref()).await?;
+    }
+    let snapshot = match &rollback {
+        Some(want) => match find_snapshot(obj, ctx, want).await? {
+            Ok(snap) => Some(snap),
+            Err(note) => {
+                req.publish(Event {
+                    type_: EventType::Warning,
+                    reason: "Rollback".into(),
+                    note: Some(note),
+                    action: "ReconcileConfig".into(),
+                    secondary: None,
+                })
+                .await;
+                return Ok(false);
+            }
+        },
+        None => None,
+    };
+    // Running a snapshot means running its digest, so switching to or from it causes a rollout.
+    let digest = snapshot
+        .as_ref()
+        .and_then(|s| {
+            s.annotations()
+                .get(CONFIG_DIGEST_ANNOTATION.as_str())
+                .cloned()
+        })
+        .unwrap_or(digest);
+    let proxy = proxy_env(ctx).await?;
+    let trusted = trusted_ca(obj, ctx).await?;
+    // The template supplies the values for any tuning that's been removed from the spec. It's
+    // only rendered once per process, so this is cheap on steady-state reconciles.
+    let tmpl: apps::v1::Deployment = new_templated(obj, ctx).await?;
     let handle = Handle::current();
 
     let mut ct = 0;
     while ct < 3 {
         ct += 1;
         trace!(ct, "reconcile attempt");
+        let mut created = false;
         let mut entry = api.entry(&name).await?.or_insert(|| {
             trace!(ct, name, "creating");
+            created = true;
             handle.block_on(new_templated(obj, ctx)).expect("template failed")
         });
         let d = entry.get_mut();
+        if !adopt(obj, d) {
+            return Err(Error::BadName(format!(
+                "Deployment {name:?} is controlled by another object"
+            )));
+        }
         trace!("checking deployment");
+        apply_common_metadata(
+            d,
+            obj.spec.common_labels.as_ref(),
+            obj.spec.common_annotations.as_ref(),
+        );
         d.labels_mut()
             .insert(COMPONENT_LABEL.to_string(), COMPONENT.into());
-        let (mut vols, mut mounts, config) = make_volumes(cfgsrc);
+        apply_hibernate(d, obj.spec.hibernate.unwrap_or(false));
+        let (mut vols, mut mounts, config) = match &snapshot {
+            Some(snap) => snapshot_volumes(snap),
+            None => make_volumes(cfgsrc),
+        };
+        if let Some((v, m)) = trusted.clone() {
+            vols.push(v);
+            mounts.push(m);
+        }
+        if let Some(scratch) = &obj.spec.scratch {
+            let (v, m) = scratch_volume(scratch);
+            vols.push(v);
+            mounts.push(m);
+        }
         if let Some(ref mut spec) = d.spec {
+            apply_rollout(spec, obj.spec.rollout.as_ref(), tmpl.spec.as_ref());
             if spec.selector.match_labels.is_none() {
                 spec.selector.match_labels = Some(Default::default());
             }
@@ -419,6 +542,11 @@ async fn check_deployment(
                 .unwrap()
                 .insert(COMPONENT_LABEL.to_string(), COMPONENT.into());
             if let Some(ref mut meta) = spec.template.metadata {
+                apply_common_meta(
+                    meta,
+                    obj.spec.common_labels.as_ref(),
+                    obj.spec.common_annotations.as_ref(),
+                );
                 if meta.labels.is_none() {
                     meta.labels = Some(Default::default());
                 }
@@ -426,16 +554,64 @@ async fn check_deployment(
                     .as_mut()
                     .unwrap()
                     .insert(COMPONENT_LABEL.to_string(), COMPONENT.into());
+                // Clair only reads its config at startup, so changing this annotation is what
+                // causes a rollout when the config changes.
+                meta.annotations
+                    .get_or_insert_with(Default::default)
+                    .insert(CONFIG_DIGEST_ANNOTATION.to_string(), digest.clone());
             }
+            apply_service_mesh(&mut spec.template, obj.spec.service_mesh.as_ref());
             if let Some(ref mut spec) = spec.template.spec {
+                apply_dns(
+                    spec,
+                    obj.spec.dns_policy.as_ref(),
+                    obj.spec.dns_config.as_ref(),
+                    &obj.spec.host_aliases,
+                    tmpl.spec.as_ref().and_then(|s| s.template.spec.as_ref()),
+                );
                 if let Some(ref mut vs) = spec.volumes {
                     vols.append(vs);
                     vols.sort_by_key(|v| v.name.clone());
                     vols.dedup_by_key(|v| v.name.clone());
+                    if obj.spec.scratch.is_none() {
+                        vols.retain(|v| v.name != SCRATCH_VOLUME);
+                    }
                     *vs = vols;
                 };
+                let tmpl_pod = tmpl.spec.as_ref().and_then(|s| s.template.spec.as_ref());
+                let scratch_kind = obj
+                    .spec
+                    .scratch
+                    .as_ref()
+                    .map(|s| s.volume.unwrap_or_default());
+                if scratch_kind == Some(v1alpha1::ScratchVolume::Ephemeral) {
+                    // Claims are usually owned by root, so make sure the unprivileged user
+                    // can write to it.
+                    let sc = spec.security_context.get_or_insert_with(Default::default);
+                    if sc.fs_group.is_none() {
+                        sc.fs_group = sc.run_as_user;
+                    }
+                } else if let Some(ref mut sc) = spec.security_context {
+                    sc.fs_group = tmpl_pod
+                        .and_then(|s| s.security_context.as_ref())
+                        .and_then(|sc| sc.fs_group);
+                }
                 if let Some(ref mut c) = spec.containers.iter_mut().find(|c| c.name == "clair") {
                     c.image = Some(want_image.clone());
+                    let request = match &obj.spec.scratch {
+                        Some(scratch)
+                            if scratch_kind == Some(v1alpha1::ScratchVolume::EmptyDir) =>
+                        {
+                            Some(scratch.size.clone())
+                        }
+                        _ => tmpl_pod
+                            .and_then(|s| s.containers.iter().find(|c| c.name == "clair"))
+                            .and_then(|c| c.resources.as_ref())
+                            .and_then(|r| r.requests.as_ref())
+                            .and_then(|r| r.get("ephemeral-storage"))
+                            .cloned(),
+                    };
+                    apply_ephemeral_storage(c, request);
                     if c.volume_mounts.is_none() {
                         c.volume_mounts = Some(Default::default());
                     }
@@ -443,6 +619,9 @@ async fn check_deployment(
                         ms.append(&mut mounts);
                         ms.sort_by_key(|m| m.name.clone());
                         ms.dedup_by_key(|m| m.name.clone());
+                        if obj.spec.scratch.is_none() {
+                            ms.retain(|m| m.name != SCRATCH_VOLUME);
+                        }
                     };
                     if c.env.is_none() {
                         c.env = Some(Default::default());
@@ -458,6 +637,12 @@ async fn check_deployment(
                             value: Some(v1alpha1::Indexer::kind(&()).to_ascii_lowercase()),
                             value_from: None,
                         });
+                        apply_proxy_env(es, &proxy);
+                        apply_runtime_env(
+                            es,
+                            c.resources.as_ref(),
+                            obj.spec.runtime_env.unwrap_or(true),
+                        );
                         es.sort_by_key(|e| e.name.clone());
                         es.dedup_by_key(|e| e.name.clone());
                     };
@@ -467,7 +652,17 @@ async fn check_deployment(
         };
         next.add_ref(d);
         match entry.commit(&CREATE_PARAMS).await {
-            Ok(()) => break,
+            Ok(()) => {
+                if created {
+                    req.created(entry.get()).await;
+                }
+                let cnd = rollout_condition(obj, req, entry.get());
+                req.transitioned(&next.conditions, &cnd, rollout_event(&cnd))
+                    .await;
+                next.add_condition(cnd);
+                next.image = resolved_image(ctx, entry.get(), &want_image).await?;
+                break;
+            }
             Err(err) => {
                 trace!(error = ?err, "commit error");
                 match err {
@@ -487,7 +682,7 @@ async fn check_deployment(
 async fn check_service(
     obj: &v1alpha1::Indexer,
     ctx: &Context,
-    _req: &Request,
+    req: &Request,
     next: &mut v1alpha1::IndexerStatus,
 ) -> Result<bool> {
     let name = obj
@@ -508,20 +703,40 @@ async fn check_service(
     let mut ok = false;
     for ct in 0..3 {
         trace!(ct, "reconcile attempt");
+        let mut created = false;
+        let mut foreign = false;
         let mut entry = api
             .entry(&name)
             .await?
             .or_insert(|| {
+                created = true;
                 futures::executor::block_on(new_templated(obj, ctx)).expect("template failed")
             })
             .and_modify(|s| {
+                if !adopt(obj, s) {
+                    foreign = true;
+                    return;
+                }
+                apply_common_metadata(
+                    s,
+                    obj.spec.common_labels.as_ref(),
+                    obj.spec.common_annotations.as_ref(),
+                );
                 s.labels_mut()
                     .insert(COMPONENT_LABEL.to_string(), COMPONENT.into());
             });
+        if foreign {
+            return Err(Error::BadName(format!(
+                "Service {name:?} is controlled by another object"
+            )));
+        }
 
         next.add_ref(entry.get());
         match entry.commit(&CREATE_PARAMS).await {
             Ok(()) => {
+                if created {
+                    req.created(entry.get()).await;
+                }
                 ok = true;
                 break;
             }
@@ -536,6 +751,7 @@ async fn check_service(
             }
         };
     }
+    select_deployment(ctx, &name, obj.spec.deployment.as_deref()).await?;
     trace!("reconciled");
     Ok(ok)
 }
@@ -544,9 +760,17 @@ async fn check_service(
 async fn check_hpa(
     obj: &v1alpha1::Indexer,
     ctx: &Context,
-    _req: &Request,
+    req: &Request,
     next: &mut v1alpha1::IndexerStatus,
 ) -> Result<bool> {
+    if obj.spec.deployment.is_some() {
+        // An existing Deployment is scaled by its owner, so drop any HPA aimed at the templated one.
+        if let Some(r) = next.has_ref::<autoscaling::v2::HorizontalPodAutoscaler>() {
+            release_owned::<_, autoscaling::v2::HorizontalPodAutoscaler>(obj, ctx, &r.name).await?;
+            next.remove_ref::<autoscaling::v2::HorizontalPodAutoscaler>();
+        }
+        return Ok(true);
+    }
     let name = obj
         .status
         .as_ref()
@@ -579,13 +803,25 @@ async fn check_hpa(
     let mut ok = false;
     for n in 0..3 {
         trace!(n, "reconcile attempt");
+        let mut created = false;
+        let mut foreign = false;
         let mut entry = api
             .entry(&name)
             .await?
             .or_insert(|| {
+                created = true;
                 futures::executor::block_on(new_templated(obj, ctx)).expect("template failed")
             })
             .and_modify(|h| {
+                if !adopt(obj, h) {
+                    foreign = true;
+                    return;
+                }
+                apply_common_metadata(
+                    h,
+                    obj.spec.common_labels.as_ref(),
+                    obj.spec.common_annotations.as_ref(),
+                );
                 h.labels_mut()
                     .insert(COMPONENT_LABEL.to_string(), COMPONENT.into());
                 if let Some(ref mut spec) = h.spec {
@@ -594,10 +830,18 @@ async fn check_hpa(
                 // TODO(hank) Check if the metrics API is enabled and if the frontend supports
                 // request-per-second metrics.
             });
+        if foreign {
+            return Err(Error::BadName(format!(
+                "HorizontalPodAutoscaler {name:?} is controlled by another object"
+            )));
+        }
 
         next.add_ref(entry.get());
         match entry.commit(&CREATE_PARAMS).await {
             Ok(()) => {
+                if created {
+                    req.created(entry.get()).await;
+                }
                 ok = true;
                 break;
             }
@@ -616,6 +860,30 @@ async fn check_hpa(
     Ok(ok)
 }
 
+#[instrument(skip_all)]
+async fn check_vpa(
+    obj: &v1alpha1::Indexer,
+    ctx: &Context,
+    _req: &Request,
+    next: &mut v1alpha1::IndexerStatus,
+) -> Result<bool> {
+    if let Some(name) = &obj.spec.deployment {
+        // Likewise for VPAs: remove any this object created, for either Deployment.
+        let templated = format!(
+            "{}-{}",
+            obj.name_any(),
+            v1alpha1::Indexer::kind(&()).to_ascii_lowercase()
+        );
+        ensure_vpa(obj, ctx, &templated, None).await?;
+        ensure_vpa(obj, ctx, name, None).await?;
+        return Ok(true);
+    }
+    if let Some(dref) = next.has_ref::<apps::v1::Deployment>() {
+        ensure_vpa(obj, ctx, &dref.name, obj.spec.vertical_autoscaling).await?;
+    }
+    Ok(true)
+}
+
 #[instrument(skip_all)]
 async fn check_creation(
     obj: &v1alpha1::Indexer,
@@ -623,7 +891,7 @@ async fn check_creation(
     req: &Request,
     next: &mut v1alpha1::IndexerStatus,
 ) -> Result<bool> {
-    let refs = [
+    let mut refs = vec![
         obj.status
             .as_ref()
             .and_then(|s| s.has_ref::<core::v1::ConfigMap>()),
@@ -633,11 +901,17 @@ async fn check_creation(
         obj.status
             .as_ref()
             .and_then(|s| s.has_ref::<core::v1::Service>()),
-        obj.status
-            .as_ref()
-            .and_then(|s| s.has_ref::<autoscaling::v2::HorizontalPodAutoscaler>()),
     ];
+    // There's no HPA for an existing Deployment.
+    if obj.spec.deployment.is_none() {
+        refs.push(
+            obj.status
+                .as_ref()
+                .and_then(|s| s.has_ref::<autoscaling::v2::HorizontalPodAutoscaler>()),
+        );
+    }
     let ok = refs.iter().all(|r| r.is_some());
+    record_initialized(obj, ok);
     let status = if ok { "True" } else { "False" }.to_string();
     let message = if ok {
         "🆗".to_string()
@@ -662,7 +936,82 @@ async fn check_creation(
     Ok(ok)
 }
 
+/// SCRATCH_VOLUME is the name of the Volume and VolumeMount backing the scratch area.
+const SCRATCH_VOLUME: &str = "scratch";
+
+/// Apply_ephemeral_storage sets the container's ephemeral-storage request to `request`, removing
+/// it if `None`.
+fn apply_ephemeral_storage(
+    c: &mut core::v1::Container,
+    request: Option<k8s_openapi::apimachinery::pkg::api::resource::Quantity>,
+) {
+    const KEY: &str = "ephemeral-storage";
+    match request {
+        Some(q) => {
+            c.resources
+                .get_or_insert_with(Default::default)
+                .requests
+                .get_or_insert_with(Default::default)
+                .insert(KEY.into(), q);
+        }
+        None => {
+            if let Some(rs) = c.resources.as_mut().and_then(|r| r.requests.as_mut()) {
+                rs.remove(KEY);
+            }
+        }
+    }
+}
+
+/// Scratch_volume returns the Volume and VolumeMount for the scratch area described by `scratch`.
+fn scratch_volume(scratch: &v1alpha1::Scratch) -> (core::v1::Volume, core::v1::VolumeMount) {
+    use self::core::v1::{
+        EmptyDirVolumeSource, EphemeralVolumeSource, PersistentVolumeClaimSpec,
+        PersistentVolumeClaimTemplate, ResourceRequirements, Volume, VolumeMount,
+    };
+    use std::collections::BTreeMap;
+    use v1alpha1::ScratchVolume;
+
+    let name = String::from(SCRATCH_VOLUME);
+    let mut v = Volume {
+        name: name.clone(),
+        ..Default::default()
+    };
+    match scratch.volume.unwrap_or_default() {
+        ScratchVolume::EmptyDir => {
+            v.empty_dir = Some(EmptyDirVolumeSource {
+                medium: None,
+                size_limit: Some(scratch.size.clone()),
+            });
+        }
+        ScratchVolume::Ephemeral => {
+            v.ephemeral = Some(EphemeralVolumeSource {
+                volume_claim_template: Some(PersistentVolumeClaimTemplate {
+                    metadata: None,
+                    spec: PersistentVolumeClaimSpec {
+                        access_modes: Some(vec!["ReadWriteOnce".into()]),
+                        storage_class_name: scratch.storage_class_name.clone(),
+                        resources: Some(ResourceRequirements {
+                            requests: Some(BTreeMap::from([(
+                                "storage".into(),
+                                scratch.size.clone(),
+                            )])),
+                            ..Default::default()
+                        }),
+                        ..Default::default()
+                    },
+                }),
+            });
+        }
+    };
+    let m = VolumeMount {
+        name,
+        mount_path: "/tmp".into(),
+        ..Default::default()
+    };
+    (v, m)
+}
+
 #[instrument(skip_all)]
-fn handle_error(_obj: Arc<v1alpha1::Indexer>, _err: &Error, _ctx: Arc<Context>) -> Action {
-    Action::await_change()
+fn handle_error(obj: Arc<v1alpha1::Indexer>, _err: &Error, ctx: Arc<Context>) -> Action {
+    Action::requeue(ctx.backoff.failed(obj.as_ref(), &ctx.tuning))
 }
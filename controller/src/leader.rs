@@ -0,0 +1,248 @@
+//! Leader holds a Lease-based leader election, so that multiple replicas of the operator can run
+//! with only one of them running controllers.
+
+use std::time::{Duration, Instant};
+
+use k8s_openapi::api::coordination::v1::{Lease, LeaseSpec};
+use tokio::task::JoinHandle;
+
+use crate::prelude::*;
+
+/// Config is the configuration for leader election.
+#[derive(Clone, Debug)]
+pub struct Config {
+    /// Name is the name of the Lease object.
+    pub name: String,
+    /// Namespace is the namespace of the Lease object. The client's default namespace is used if
+    /// not provided.
+    pub namespace: Option<String>,
+    /// Identity is the name this process holds the Lease under.
+    pub identity: String,
+    /// Lease_duration is how long other candidates wait before taking over an un-renewed Lease.
+    pub lease_duration: Duration,
+    /// Renew_deadline is how long the leader keeps retrying a failed renewal before giving up.
+    pub renew_deadline: Duration,
+    /// Retry_period is how often candidates try to acquire, and the leader renews, the Lease.
+    pub retry_period: Duration,
+}
+
+/// Observed is the last Lease record seen, and when it was seen.
+///
+/// Expiry is judged by how long the record has gone unchanged on the local clock, rather than by
+/// comparing the record's renew time to it, so that clock skew between replicas doesn't matter.
+#[derive(Debug)]
+struct Observed {
+    spec: Option<LeaseSpec>,
+    at: Instant,
+}
+
+impl Observed {
+    fn new() -> Observed {
+        Observed {
+            spec: None,
+            at: Instant::now(),
+        }
+    }
+
+    /// Update records `spec`, resetting the observed time if it's changed.
+    fn update(&mut self, spec: Option<&LeaseSpec>) {
+        if self.spec.as_ref() != spec {
+            self.spec = spec.cloned();
+            self.at = Instant::now();
+        }
+    }
+
+    /// Available reports whether `identity` may take or keep the Lease.
+    fn available(&self, identity: &str) -> bool {
+        let spec = match &self.spec {
+            Some(spec) => spec,
+            None => return true,
+        };
+        let holder = spec.holder_identity.as_deref().unwrap_or_default();
+        if holder.is_empty() || holder == identity {
+            return true;
+        }
+        let duration = Duration::from_secs(spec.lease_duration_seconds.unwrap_or_default() as u64);
+        self.at.elapsed() > duration
+    }
+}
+
+/// Acquire waits until this process holds the Lease described by `cfg`, then spawns a task to keep
+/// renewing it.
+///
+/// If the Lease is lost, `cancel` is cancelled. Once `cancel` is cancelled, the Lease is released
+/// so another replica can take over without waiting for it to expire; awaiting the returned handle
+/// waits for that to happen. `None` is returned if `cancel` is cancelled before the Lease is
+/// acquired.
+///
+/// An error is returned if `cfg` has an empty identity, as that's indistinguishable from a released
+/// Lease.
+#[instrument(skip_all, fields(name = cfg.name, identity = cfg.identity))]
+pub async fn acquire(
+    client: kube::Client,
+    cfg: Config,
+    cancel: CancellationToken,
+) -> Result<Option<JoinHandle<()>>> {
+    if cfg.identity.is_empty() {
+        return Err(Error::BadName(
+            "leader election identity must not be empty".into(),
+        ));
+    }
+    let api: Api<Lease> = match &cfg.namespace {
+        Some(ns) => Api::namespaced(client, ns),
+        None => Api::default_namespaced(client),
+    };
+    let mut seen = Observed::new();
+    loop {
+        match try_acquire(&api, &cfg, &mut seen).await {
+            Ok(true) => break,
+            Ok(false) => trace!("lease held elsewhere"),
+            Err(error) => warn!(%error, "unable to acquire lease"),
+        };
+        tokio::select! {
+            _ = cancel.cancelled() => return Ok(None),
+            _ = tokio::time::sleep(cfg.retry_period) => {},
+        };
+    }
+    info!("acquired lease");
+
+    Ok(Some(tokio::spawn(async move {
+        let mut renewed = Instant::now();
+        loop {
+            tokio::select! {
+                _ = cancel.cancelled() => break,
+                _ = tokio::time::sleep(cfg.retry_period) => {},
+            };
+            match try_acquire(&api, &cfg, &mut seen).await {
+                Ok(true) => {
+                    trace!("renewed lease");
+                    renewed = Instant::now();
+                }
+                Ok(false) => {
+                    error!("lost lease");
+                    cancel.cancel();
+                    return;
+                }
+                Err(error) => {
+                    warn!(%error, "unable to renew lease");
+                    if renewed.elapsed() > cfg.renew_deadline {
+                        error!("renew deadline exceeded, giving up lease");
+                        cancel.cancel();
+                        break;
+                    }
+                }
+            };
+        }
+        match release(&api, &cfg).await {
+            Ok(()) => info!("released lease"),
+            Err(error) => warn!(%error, "unable to release lease"),
+        };
+    })))
+}
+
+/// Try_acquire attempts to acquire or renew the Lease, reporting if this process holds it.
+///
+/// `seen` tracks the Lease record across calls, to tell when another holder's Lease has expired.
+async fn try_acquire(api: &Api<Lease>, cfg: &Config, seen: &mut Observed) -> Result<bool> {
+    let now = meta::v1::MicroTime(Utc::now());
+    let secs = cfg.lease_duration.as_secs() as i32;
+    let mut lease = match api.get_opt(&cfg.name).await? {
+        Some(lease) => lease,
+        None => {
+            let lease = Lease {
+                metadata: meta::v1::ObjectMeta {
+                    name: Some(cfg.name.clone()),
+                    ..Default::default()
+                },
+                spec: Some(LeaseSpec {
+                    holder_identity: Some(cfg.identity.clone()),
+                    lease_duration_seconds: Some(secs),
+                    acquire_time: Some(now.clone()),
+                    renew_time: Some(now),
+                    lease_transitions: Some(0),
+                }),
+            };
+            return match api.create(&CREATE_PARAMS, &lease).await {
+                Ok(_) => Ok(true),
+                Err(kube::Error::Api(err)) if err.code == 409 => Ok(false),
+                Err(err) => Err(err.into()),
+            };
+        }
+    };
+
+    seen.update(lease.spec.as_ref());
+    if !seen.available(&cfg.identity) {
+        return Ok(false);
+    }
+    let spec = lease.spec.get_or_insert_with(Default::default);
+    let holder = spec.holder_identity.clone().unwrap_or_default();
+    if holder != cfg.identity {
+        debug!(previous = holder, "taking over lease");
+        spec.holder_identity = Some(cfg.identity.clone());
+        spec.acquire_time = Some(now.clone());
+        spec.lease_transitions = Some(spec.lease_transitions.unwrap_or_default() + 1);
+    }
+    spec.lease_duration_seconds = Some(secs);
+    spec.renew_time = Some(now);
+    // The resourceVersion from the read is sent along, so this fails if another candidate has
+    // modified the Lease in the meantime.
+    match api.replace(&cfg.name, &CREATE_PARAMS, &lease).await {
+        Ok(_) => Ok(true),
+        Err(kube::Error::Api(err)) if err.code == 409 => Ok(false),
+        Err(err) => Err(err.into()),
+    }
+}
+
+/// Release gives up the Lease, if this process still holds it.
+async fn release(api: &Api<Lease>, cfg: &Config) -> Result<()> {
+    let mut lease = match api.get_opt(&cfg.name).await? {
+        Some(lease) => lease,
+        None => return Ok(()),
+    };
+    if let Some(spec) = lease.spec.as_mut() {
+        if spec.holder_identity.as_deref() != Some(cfg.identity.as_str()) {
+            return Ok(());
+        }
+        spec.holder_identity = None;
+        spec.acquire_time = None;
+        spec.renew_time = None;
+    }
+    api.replace(&cfg.name, &CREATE_PARAMS, &lease).await?;
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn held_by(holder: &str) -> LeaseSpec {
+        LeaseSpec {
+            holder_identity: Some(holder.into()),
+            lease_duration_seconds: Some(1),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn observed_available() {
+        let mut seen = Observed::new();
+        assert!(seen.available("me"), "no record should be available");
+
+        seen.update(Some(&held_by("")));
+        assert!(seen.available("me"), "released lease should be available");
+
+        seen.update(Some(&held_by("me")));
+        assert!(seen.available("me"), "own lease should be available");
+
+        seen.update(Some(&held_by("other")));
+        assert!(!seen.available("me"), "fresh lease should be held");
+        seen.at -= Duration::from_secs(2);
+        assert!(seen.available("me"), "expired lease should be available");
+
+        // A renewal by the holder resets the observed time, whatever the renew time says.
+        let mut renewed = held_by("other");
+        renewed.renew_time = Some(meta::v1::MicroTime(Utc::now() - chrono::Duration::hours(1)));
+        seen.update(Some(&renewed));
+        assert!(!seen.available("me"), "renewed lease should be held");
+    }
+}
@@ -4,7 +4,7 @@
 //! Controller implements common functionality for the controller binary and controller functions
 //! themselves.
 
-use std::{borrow::Cow, env, pin::Pin};
+use std::{borrow::Cow, env, pin::Pin, time::Duration};
 
 // TODO(hank) Use std::sync::LazyLock once it stabilizes.
 use chrono::Utc;
@@ -13,7 +13,7 @@ use k8s_openapi::{api::core, apimachinery::pkg::apis::meta};
 use kube::runtime::events;
 use lazy_static::lazy_static;
 use regex::Regex;
-use tracing::{instrument, trace};
+use tracing::{debug, instrument, trace, warn};
 
 use api::v1alpha1;
 
@@ -43,16 +43,26 @@ pub(crate) mod prelude {
     pub use tokio_util::sync::CancellationToken;
     pub use tracing::{debug, error, info, instrument, trace, warn};
 
-    pub use api::v1alpha1::{self, CrdCommon, SpecCommon, StatusCommon};
+    pub use api::v1alpha1::{self, CommonMetadata, CrdCommon, SpecCommon, StatusCommon};
 
     pub use super::templates;
-    pub use super::{default_dropin, make_volumes, new_templated};
-    pub use super::{Context, ControllerFuture, Error, Request, Result};
+    pub use super::{
+        adopt, apply_common_meta, apply_common_metadata, apply_dns, apply_hibernate,
+        apply_proxy_env, apply_rollout, apply_runtime_env, apply_selector, apply_service_mesh,
+        config_digest, create_or_adopt, default_dropin, ensure_vpa, existing_deployment,
+        find_snapshot, limited, make_volumes, measure, new_templated, proxy_env,
+        record_initialized, release_owned, resolved_image, rollout_condition, rollout_event,
+        select_deployment, snapshot_config, snapshot_volumes, trusted_ca, watch_configs,
+        watch_deployments, watch_proxy,
+    };
+    pub use super::{Backoff, Context, ControllerFuture, Error, Request, Result, Tuning};
     pub use super::{CONTROLLER_NAME, CREATE_PARAMS, PATCH_PARAMS};
 }
 
+pub mod certs;
 pub mod clairs;
 pub mod indexers;
+pub mod leader;
 pub mod matchers;
 
 pub mod templates;
@@ -68,6 +78,9 @@ pub enum Error {
     /// Tracing indicates the error came from installing the tracing subsriber.
     #[error("tracing error: {0}")]
     Tracing(#[from] tracing::subscriber::SetGlobalDefaultError),
+    /// Otel indicates the error came from setting up the OpenTelemetry exporter.
+    #[error("opentelemetry error: {0}")]
+    Otel(#[from] opentelemetry::trace::TraceError),
     /// Kube is a generic error from the `kube` crate.
     #[error("kube error: {0}")]
     Kube(#[from] kube::Error),
@@ -97,6 +110,9 @@ pub enum Error {
     /// Tokio inidicates an error starting tasks.
     #[error("tokio error: {0}")]
     Tokio(#[from] tokio::task::JoinError),
+    /// Cert indicates an error generating certificates.
+    #[error("certificate error: {0}")]
+    Cert(#[from] openssl::error::ErrorStack),
     /// TLS inidicates some TLS error.
     #[error("tls error: {0}")]
     TLS(#[from] tokio_native_tls::native_tls::Error),
@@ -130,6 +146,108 @@ pub struct Context {
     pub client: kube::Client,
     /// Image is the fallback container image to use.
     pub image: String,
+    /// Proxy is the resource for the OpenShift cluster-wide Proxy, if the cluster serves one.
+    pub proxy: Option<kube::core::ApiResource>,
+    /// Vpa is the resource for VerticalPodAutoscalers, if the cluster serves them.
+    pub vpa: Option<kube::core::ApiResource>,
+    /// Tuning is the queueing behavior for controllers.
+    pub tuning: Tuning,
+    /// Config_selector is a label selector limiting which ConfigMaps and Secrets are watched for
+    /// config changes. All of them are watched if unset.
+    pub config_selector: Option<String>,
+    /// Backoff tracks failing objects, to space out their retries.
+    pub backoff: Backoff,
+}
+
+/// Tuning controls how controllers queue and retry work.
+#[derive(Clone, Debug)]
+pub struct Tuning {
+    /// Debounce is how long to wait for further changes to an object before reconciling it.
+    pub debounce: Duration,
+    /// Error_requeue is how long to wait before retrying an object that failed to reconcile. The
+    /// wait doubles with every further consecutive failure.
+    pub error_requeue: Duration,
+    /// Max_error_requeue is the longest an object that keeps failing to reconcile waits between
+    /// retries.
+    pub max_error_requeue: Duration,
+    /// Resync is how long an unchanged object waits before being reconciled again.
+    pub resync: Duration,
+    /// Concurrency is how many objects a controller reconciles at once. Zero means no limit.
+    ///
+    /// A single object is never reconciled concurrently with itself.
+    pub concurrency: u16,
+}
+
+impl Default for Tuning {
+    fn default() -> Self {
+        Self {
+            debounce: Duration::ZERO,
+            error_requeue: Duration::from_secs(1),
+            max_error_requeue: Duration::from_secs(300),
+            resync: Duration::from_secs(3600),
+            concurrency: 0,
+        }
+    }
+}
+
+impl Tuning {
+    /// Controller_config returns the runtime configuration for a controller.
+    pub fn controller_config(&self) -> kube::runtime::controller::Config {
+        kube::runtime::controller::Config::default().debounce(self.debounce)
+    }
+
+    /// Limiter returns a semaphore bounding how many objects one controller reconciles at once, or
+    /// `None` if there's no limit. Each controller needs its own.
+    pub fn limiter(&self) -> Option<std::sync::Arc<tokio::sync::Semaphore>> {
+        (self.concurrency > 0)
+            .then(|| std::sync::Arc::new(tokio::sync::Semaphore::new(self.concurrency.into())))
+    }
+}
+
+/// Backoff counts consecutive reconcile failures per object, so retries of an object that keeps
+/// failing are spaced out exponentially.
+#[derive(Debug, Default)]
+pub struct Backoff(std::sync::Mutex<std::collections::HashMap<String, u32>>);
+
+impl Backoff {
+    /// Failed records a failed reconcile of `obj`, returning how long to wait before retrying it.
+    pub fn failed<K>(&self, obj: &K, tuning: &Tuning) -> Duration
+    where
+        K: kube::Resource<DynamicType = ()>,
+    {
+        let mut seen = self.0.lock().expect("backoff lock poisoned");
+        let n = seen.entry(Self::key(obj)).or_default();
+        let wait = tuning
+            .error_requeue
+            .saturating_mul(2u32.saturating_pow(*n))
+            .min(tuning.max_error_requeue);
+        *n = n.saturating_add(1);
+        wait
+    }
+
+    /// Succeeded forgets any failures of `obj`.
+    pub fn succeeded<K>(&self, obj: &K)
+    where
+        K: kube::Resource<DynamicType = ()>,
+    {
+        self.0
+            .lock()
+            .expect("backoff lock poisoned")
+            .remove(&Self::key(obj));
+    }
+
+    fn key<K>(obj: &K) -> String
+    where
+        K: kube::Resource<DynamicType = ()>,
+    {
+        use kube::ResourceExt;
+        format!(
+            "{}/{}/{}",
+            K::kind(&()),
+            obj.namespace().unwrap_or_default(),
+            obj.name_any()
+        )
+    }
 }
 
 impl std::fmt::Debug for Context {
@@ -157,8 +275,44 @@ impl Request {
         self.now.clone()
     }
     /// Publish publishes a kubernetes Event.
-    pub async fn publish(&self, ev: events::Event) -> Result<()> {
-        Ok(self.recorder.publish(ev).await?)
+    ///
+    /// Events are informational, so failing to publish one is logged rather than returned.
+    pub async fn publish(&self, ev: events::Event) {
+        if let Err(error) = self.recorder.publish(ev).await {
+            warn!(%error, "unable to publish event");
+        }
+    }
+    /// Created publishes a kubernetes Event noting that `obj` was created from a template.
+    pub async fn created<K>(&self, obj: &K)
+    where
+        K: kube::Resource<DynamicType = ()>,
+    {
+        use kube::ResourceExt;
+        self.publish(events::Event {
+            type_: events::EventType::Normal,
+            reason: "Created".into(),
+            note: Some(format!("created {} {:?}", K::kind(&()), obj.name_any())),
+            action: "ObjectCreation".into(),
+            secondary: Some(obj.object_ref(&())),
+        })
+        .await
+    }
+    /// Transitioned publishes `ev` if the condition `cnd` has a different status than the condition
+    /// of the same type in `prev`. Nothing is published for a condition that wasn't present before.
+    pub async fn transitioned(
+        &self,
+        prev: &[meta::v1::Condition],
+        cnd: &meta::v1::Condition,
+        ev: events::Event,
+    ) {
+        let changed = prev
+            .iter()
+            .find(|c| c.type_ == cnd.type_)
+            .map(|c| c.status != cnd.status)
+            .unwrap_or(false);
+        if changed {
+            self.publish(ev).await;
+        }
     }
 }
 
@@ -174,6 +328,57 @@ lazy_static! {
     };
 }
 
+/// Measure drives the reconcile future `fut`, recording its duration and outcome as metrics
+/// labeled with `kind`.
+pub async fn measure<F>(kind: &'static str, fut: F) -> Result<kube::runtime::controller::Action>
+where
+    F: Future<Output = Result<kube::runtime::controller::Action>>,
+{
+    let start = std::time::Instant::now();
+    let res = fut.await;
+    let result = if res.is_ok() { "success" } else { "error" };
+    metrics::histogram!(
+        "clair_operator_reconcile_duration_seconds",
+        start.elapsed().as_secs_f64(),
+        "kind" => kind
+    );
+    metrics::increment_counter!(
+        "clair_operator_reconcile_total",
+        "kind" => kind,
+        "result" => result
+    );
+    res
+}
+
+/// Limited drives the reconcile future `fut` once a permit from `limit`, as returned by
+/// [`Tuning::limiter`], is available.
+pub async fn limited<F, T>(limit: Option<std::sync::Arc<tokio::sync::Semaphore>>, fut: F) -> T
+where
+    F: Future<Output = T>,
+{
+    let _permit = match limit {
+        Some(sem) => Some(sem.acquire_owned().await.expect("limiter closed")),
+        None => None,
+    };
+    fut.await
+}
+
+/// Record_initialized sets the per-object gauge reporting whether all the objects for `obj` have
+/// been created.
+pub fn record_initialized<K>(obj: &K, ok: bool)
+where
+    K: kube::Resource<DynamicType = ()>,
+{
+    use kube::ResourceExt;
+    metrics::gauge!(
+        "clair_operator_initialized",
+        if ok { 1.0 } else { 0.0 },
+        "kind" => K::kind(&()).to_string(),
+        "namespace" => obj.namespace().unwrap_or_default(),
+        "name" => obj.name_any()
+    );
+}
+
 /// Condition is like [keyify], but does not force lower-case.
 fn condition<S: ToString, K: AsRef<str>>(space: S, key: K) -> String {
     let mut out = space.to_string();
@@ -256,6 +461,65 @@ where
     Ok(v)
 }
 
+/// Adopt makes `obj` the controller of `child` if `child` has no controller, so that resources
+/// that existed before the operator managed them are taken over instead of fought over.
+///
+/// Reports whether `child` is controlled by `obj`.
+pub fn adopt<S, K>(obj: &S, child: &mut K) -> bool
+where
+    S: v1alpha1::CrdCommon,
+    K: kube::Resource<DynamicType = ()>,
+{
+    use kube::ResourceExt;
+    let oref = obj
+        .controller_owner_ref(&())
+        .expect("unable to create owner ref");
+    let name = child.name_any();
+    let refs = child
+        .meta_mut()
+        .owner_references
+        .get_or_insert_with(Default::default);
+    match refs.iter().find(|r| r.controller == Some(true)) {
+        Some(r) => r.uid == oref.uid,
+        None => {
+            trace!(kind = %K::kind(&()), name, "adopting");
+            refs.push(oref);
+            true
+        }
+    }
+}
+
+/// Create_or_adopt creates the templated `K` for `obj`, or adopts the existing object of the same
+/// name.
+///
+/// Reports whether the object was newly created.
+pub async fn create_or_adopt<S, K>(obj: &S, ctx: &Context) -> Result<(K, bool)>
+where
+    S: v1alpha1::CrdCommon,
+    K: kube::Resource<DynamicType = (), Scope = k8s_openapi::NamespaceResourceScope>
+        + Clone
+        + serde::de::DeserializeOwned
+        + serde::Serialize
+        + std::fmt::Debug,
+{
+    use kube::ResourceExt;
+    let want: K = new_templated(obj, ctx).await?;
+    let name = want.name_any();
+    let api = kube::Api::<K>::default_namespaced(ctx.client.clone());
+    match api.get_opt(&name).await? {
+        None => Ok((api.create(&CREATE_PARAMS, &want).await?, true)),
+        Some(mut cur) => {
+            if !adopt(obj, &mut cur) {
+                return Err(Error::BadName(format!(
+                    "{} {name:?} is controlled by another object",
+                    K::kind(&())
+                )));
+            }
+            Ok((api.replace(&name, &CREATE_PARAMS, &cur).await?, false))
+        }
+    }
+}
+
 /// Default_dropin creates a default dropin describing the provided object, returning the name of
 /// the ConfigMap key it was placed in and the created ConfigMap.
 #[instrument(skip_all)]
@@ -396,6 +660,1087 @@ pub fn make_volumes(
     (vols, mounts, filename)
 }
 
+/// Config_digest returns a digest over the contents of every config file referenced by `cfgsrc`.
+#[instrument(skip_all)]
+pub async fn config_digest(
+    client: &kube::Client,
+    cfgsrc: &v1alpha1::ConfigSource,
+) -> Result<String> {
+    use clair_config::{ConfigObject, K8sMap};
+    use sha2::{Digest, Sha256};
+
+    use self::core::v1::{ConfigMap, Secret};
+
+    let cm_api: kube::Api<ConfigMap> = kube::Api::default_namespaced(client.clone());
+    let sec_api: kube::Api<Secret> = kube::Api::default_namespaced(client.clone());
+    let mut h = Sha256::new();
+
+    let root = cm_api.get(&cfgsrc.root.name).await?;
+    h.update(&cfgsrc.root.key);
+    h.update(root.value(cfgsrc.root.key.clone()).unwrap_or_default());
+    for d in cfgsrc.dropins.iter() {
+        let (key, obj) = if let Some(r) = &d.config_map_key_ref {
+            (&r.key, ConfigObject::from(cm_api.get(&r.name).await?))
+        } else if let Some(r) = &d.secret_key_ref {
+            (&r.key, ConfigObject::from(sec_api.get(&r.name).await?))
+        } else {
+            unreachable!()
+        };
+        let buf = obj.value(key.clone());
+        trace!(key, found = buf.is_some(), "hashing dropin");
+        h.update(key);
+        h.update(buf.unwrap_or_default());
+    }
+    Ok(format!("{:x}", h.finalize()))
+}
+
+/// Snapshot_config stores the contents of every config file referenced by `cfgsrc` in an immutable
+/// Secret owned by `obj`, labelled so it can be found by [`find_snapshot`], then deletes all but the
+/// newest `keep` snapshots. A snapshot whose digest starts with `protect` is never deleted.
+///
+/// Nothing is stored if a snapshot of `digest` already exists.
+#[instrument(skip_all)]
+pub async fn snapshot_config<S>(
+    obj: &S,
+    ctx: &Context,
+    cfgsrc: &v1alpha1::ConfigSource,
+    digest: &str,
+    keep: usize,
+    protect: Option<&str>,
+) -> Result<()>
+where
+    S: v1alpha1::CrdCommon + v1alpha1::CommonMetadata,
+{
+    use std::collections::BTreeMap;
+
+    use clair_config::{ConfigObject, K8sMap};
+    use k8s_openapi::ByteString;
+    use kube::ResourceExt;
+
+    use self::core::v1::{ConfigMap, Secret};
+
+    let uid = obj
+        .uid()
+        .ok_or(Error::BadName("object has no uid".into()))?;
+    let cm_api: kube::Api<ConfigMap> = kube::Api::default_namespaced(ctx.client.clone());
+    let sec_api: kube::Api<Secret> = kube::Api::default_namespaced(ctx.client.clone());
+    let name = format!(
+        "{}-{}-config-{}",
+        obj.name_any(),
+        S::kind(&()).to_ascii_lowercase(),
+        &digest[..12]
+    );
+
+    if sec_api.get_opt(&name).await?.is_none() {
+        // Entries are keyed by their source, so a dropin can't overwrite the root config or
+        // another dropin that happens to use the same key.
+        let mut data = BTreeMap::new();
+        let root = cm_api.get(&cfgsrc.root.name).await?;
+        if let Some(buf) = root.value(cfgsrc.root.key.clone()) {
+            data.insert(snapshot_key(None, &cfgsrc.root.key), ByteString(buf));
+        }
+        for (i, d) in cfgsrc.dropins.iter().enumerate() {
+            let (key, src) = if let Some(r) = &d.config_map_key_ref {
+                (&r.key, ConfigObject::from(cm_api.get(&r.name).await?))
+            } else if let Some(r) = &d.secret_key_ref {
+                (&r.key, ConfigObject::from(sec_api.get(&r.name).await?))
+            } else {
+                unreachable!()
+            };
+            if let Some(buf) = src.value(key.clone()) {
+                data.insert(snapshot_key(Some(i), key), ByteString(buf));
+            }
+        }
+        let mut snap = Secret {
+            metadata: meta::v1::ObjectMeta {
+                name: Some(name.clone()),
+                labels: Some(BTreeMap::from([(
+                    CONFIG_HISTORY_LABEL.to_string(),
+                    uid.clone(),
+                )])),
+                annotations: Some(BTreeMap::from([
+                    (CONFIG_DIGEST_ANNOTATION.to_string(), digest.to_string()),
+                    (CONFIG_ROOT_ANNOTATION.to_string(), cfgsrc.root.key.clone()),
+                ])),
+                owner_references: Some(vec![obj
+                    .controller_owner_ref(&())
+                    .expect("unable to create owner ref")]),
+                ..Default::default()
+            },
+            data: Some(data),
+            immutable: Some(true),
+            ..Default::default()
+        };
+        apply_common_metadata(&mut snap, obj.common_labels(), obj.common_annotations());
+        match sec_api.create(&CREATE_PARAMS, &snap).await {
+            Ok(_) => debug!(name, "stored config snapshot"),
+            Err(kube::Error::Api(err)) if err.code == 409 => {}
+            Err(err) => return Err(err.into()),
+        };
+    }
+
+    let mut snaps = sec_api
+        .list(&kube::api::ListParams::default().labels(&format!("{}={uid}", *CONFIG_HISTORY_LABEL)))
+        .await?
+        .items;
+    snaps.sort_by_key(|s| std::cmp::Reverse(s.creation_timestamp()));
+    for s in snaps.iter().skip(keep) {
+        let d = s
+            .annotations()
+            .get(CONFIG_DIGEST_ANNOTATION.as_str())
+            .map(String::as_str)
+            .unwrap_or_default();
+        if protect.map(|p| d.starts_with(p)).unwrap_or(false) {
+            continue;
+        }
+        trace!(name = s.name_any(), "pruning config snapshot");
+        sec_api
+            .delete(&s.name_any(), &kube::api::DeleteParams::default())
+            .await?;
+    }
+    Ok(())
+}
+
+/// Snapshot_key returns the key a config file is stored under in a snapshot: "root.{key}" for the
+/// root config, and "dropin-{i}.{key}" for the `i`th dropin.
+///
+/// Secret keys can't contain a "/", but the prefixes never contain a ".", so everything after the
+/// first "." is the original key.
+fn snapshot_key(dropin: Option<usize>, key: &str) -> String {
+    match dropin {
+        None => format!("root.{key}"),
+        Some(i) => format!("dropin-{i}.{key}"),
+    }
+}
+
+/// Find_snapshot returns the config snapshot for `obj` whose digest starts with `want`.
+///
+/// The inner error describes why no single snapshot matched, for reporting to the user.
+pub async fn find_snapshot<S>(
+    obj: &S,
+    ctx: &Context,
+    want: &str,
+) -> Result<std::result::Result<core::v1::Secret, String>>
+where
+    S: v1alpha1::CrdCommon,
+{
+    use kube::ResourceExt;
+
+    let uid = match obj.uid() {
+        Some(uid) => uid,
+        None => return Ok(Err("object has no uid".into())),
+    };
+    if want.len() < MIN_SNAPSHOT_PREFIX {
+        return Ok(Err(format!(
+            "config snapshot prefix {want:?} is shorter than {MIN_SNAPSHOT_PREFIX} characters"
+        )));
+    }
+    let api: kube::Api<core::v1::Secret> = kube::Api::default_namespaced(ctx.client.clone());
+    let snaps = api
+        .list(&kube::api::ListParams::default().labels(&format!("{}={uid}", *CONFIG_HISTORY_LABEL)))
+        .await?
+        .items;
+    Ok(match_snapshot(snaps, want))
+}
+
+/// MIN_SNAPSHOT_PREFIX is the shortest digest prefix accepted to select a config snapshot.
+const MIN_SNAPSHOT_PREFIX: usize = 8;
+
+/// Match_snapshot picks the one snapshot out of `snaps` whose digest starts with `want`.
+fn match_snapshot(
+    snaps: Vec<core::v1::Secret>,
+    want: &str,
+) -> std::result::Result<core::v1::Secret, String> {
+    use kube::ResourceExt;
+
+    let mut found = snaps.into_iter().filter(|s| {
+        s.annotations()
+            .get(CONFIG_DIGEST_ANNOTATION.as_str())
+            .map(|d| d.starts_with(want))
+            .unwrap_or(false)
+    });
+    match (found.next(), found.next()) {
+        (Some(snap), None) => Ok(snap),
+        (None, _) => Err(format!("no config snapshot matching {want:?}")),
+        (Some(_), Some(_)) => Err(format!("more than one config snapshot matching {want:?}")),
+    }
+}
+
+/// Snapshot_volumes is like [`make_volumes`], but mounts the files from the config snapshot `snap`.
+pub fn snapshot_volumes(
+    snap: &core::v1::Secret,
+) -> (Vec<core::v1::Volume>, Vec<core::v1::VolumeMount>, String) {
+    use kube::ResourceExt;
+
+    use self::core::v1::{KeyToPath, SecretVolumeSource, Volume, VolumeMount};
+
+    let name = snap.name_any();
+    let root = snap
+        .annotations()
+        .get(CONFIG_ROOT_ANNOTATION.as_str())
+        .cloned()
+        .unwrap_or_default();
+    let filename = String::from("/etc/clair/") + &root;
+    let item = |key: &str, path: &str| KeyToPath {
+        key: key.into(),
+        path: path.into(),
+        mode: None,
+    };
+    let keys = snap.data.iter().flat_map(|d| d.keys());
+    let root_key = snapshot_key(None, &root);
+    let (root_item, dropins) = if snap
+        .data
+        .as_ref()
+        .map(|d| d.contains_key(&root_key))
+        .unwrap_or(false)
+    {
+        let dropins = keys
+            .filter(|k| k.starts_with("dropin-"))
+            .filter_map(|k| k.split_once('.').map(|(_, path)| item(k.as_str(), path)))
+            .collect::<Vec<_>>();
+        (item(root_key.as_str(), root.as_str()), dropins)
+    } else {
+        // Snapshots taken before entries were keyed by source store every file under its own key.
+        let dropins = keys
+            .filter(|k| **k != root)
+            .map(|k| item(k.as_str(), k.as_str()))
+            .collect::<Vec<_>>();
+        (item(root.as_str(), root.as_str()), dropins)
+    };
+
+    let vols = vec![
+        Volume {
+            name: "root-config".into(),
+            secret: Some(SecretVolumeSource {
+                secret_name: Some(name.clone()),
+                items: Some(vec![root_item]),
+                default_mode: Some(0o644),
+                optional: Some(false),
+            }),
+            ..Default::default()
+        },
+        Volume {
+            name: "dropins".into(),
+            secret: Some(SecretVolumeSource {
+                secret_name: Some(name),
+                items: Some(dropins),
+                default_mode: Some(0o644),
+                optional: Some(false),
+            }),
+            ..Default::default()
+        },
+    ];
+    let mounts = vec![
+        VolumeMount {
+            name: "root-config".into(),
+            mount_path: filename.clone(),
+            sub_path: Some(root),
+            ..Default::default()
+        },
+        VolumeMount {
+            name: "dropins".into(),
+            mount_path: filename.clone() + ".d",
+            ..Default::default()
+        },
+    ];
+    (vols, mounts, filename)
+}
+
+/// Proxy_gvk is the kind for the OpenShift cluster-wide Proxy.
+pub fn proxy_gvk() -> kube::core::GroupVersionKind {
+    kube::core::GroupVersionKind::gvk("config.openshift.io", "v1", "Proxy")
+}
+
+/// Vpa_gvk returns the GroupVersionKind for the VerticalPodAutoscaler.
+pub fn vpa_gvk() -> kube::core::GroupVersionKind {
+    kube::core::GroupVersionKind::gvk("autoscaling.k8s.io", "v1", "VerticalPodAutoscaler")
+}
+
+/// Ensure_vpa creates or updates a VerticalPodAutoscaler owned by `obj` for the Deployment named
+/// `target`, or removes it if `mode` is `None`.
+///
+/// Nothing is done if the cluster doesn't serve VerticalPodAutoscalers.
+#[instrument(skip_all)]
+pub async fn ensure_vpa<S>(
+    obj: &S,
+    ctx: &Context,
+    target: &str,
+    mode: Option<v1alpha1::VerticalAutoscaling>,
+) -> Result<()>
+where
+    S: v1alpha1::CrdCommon + v1alpha1::CommonMetadata,
+{
+    use kube::{
+        api::{DeleteParams, DynamicObject, Patch},
+        ResourceExt,
+    };
+    let ar = match &ctx.vpa {
+        Some(ar) => ar,
+        None => {
+            if mode.is_some() {
+                warn!("vertical autoscaling requested, but VerticalPodAutoscalers are not served");
+            }
+            return Ok(());
+        }
+    };
+    let api: kube::Api<DynamicObject> = kube::Api::default_namespaced_with(ctx.client.clone(), ar);
+    let mode = match mode {
+        Some(mode) => mode,
+        None => {
+            // Only remove a VerticalPodAutoscaler this object created.
+            let uid = obj.meta().uid.as_deref();
+            let owned = api
+                .get_opt(target)
+                .await?
+                .map(|v| {
+                    v.owner_references()
+                        .iter()
+                        .any(|r| Some(r.uid.as_str()) == uid)
+                })
+                .unwrap_or(false);
+            if owned {
+                api.delete(target, &DeleteParams::default()).await?;
+                debug!(name = target, "deleted VerticalPodAutoscaler");
+            }
+            return Ok(());
+        }
+    };
+
+    let mut vpa = DynamicObject::new(target, ar).data(serde_json::json!({
+        "spec": {
+            "targetRef": {
+                "apiVersion": "apps/v1",
+                "kind": "Deployment",
+                "name": target,
+            },
+            "updatePolicy": {
+                "updateMode": mode.to_string(),
+            },
+            // The HorizontalPodAutoscaler scales on CPU, so leave that alone.
+            "resourcePolicy": {
+                "containerPolicies": [{
+                    "containerName": "clair",
+                    "controlledResources": ["memory"],
+                }],
+            },
+        },
+    }));
+    vpa.owner_references_mut().push(
+        obj.controller_owner_ref(&())
+            .expect("unable to create owner ref"),
+    );
+    apply_common_metadata(&mut vpa, obj.common_labels(), obj.common_annotations());
+    api.patch(target, &PATCH_PARAMS, &Patch::Apply(&vpa))
+        .await?;
+    trace!(name = target, %mode, "applied VerticalPodAutoscaler");
+    Ok(())
+}
+
+const PROXY_VARS: [(&str, &str); 3] = [
+    ("httpProxy", "HTTP_PROXY"),
+    ("httpsProxy", "HTTPS_PROXY"),
+    ("noProxy", "NO_PROXY"),
+];
+
+/// Proxy_env returns the environment variables needed to use the cluster-wide Proxy.
+///
+/// An empty Vec is returned if the cluster has no Proxy configured.
+#[instrument(skip_all)]
+pub async fn proxy_env(ctx: &Context) -> Result<Vec<core::v1::EnvVar>> {
+    let ar = match &ctx.proxy {
+        Some(ar) => ar,
+        None => return Ok(Vec::new()),
+    };
+    let api: kube::Api<kube::api::DynamicObject> = kube::Api::all_with(ctx.client.clone(), ar);
+    let status = match api.get_opt("cluster").await? {
+        Some(p) => p.data.get("status").cloned().unwrap_or_default(),
+        None => return Ok(Vec::new()),
+    };
+    Ok(PROXY_VARS
+        .iter()
+        .filter_map(|(key, name)| {
+            status
+                .get(key)
+                .and_then(|v| v.as_str())
+                .filter(|v| !v.is_empty())
+                .map(|v| core::v1::EnvVar {
+                    name: name.to_string(),
+                    value: Some(v.into()),
+                    value_from: None,
+                })
+        })
+        .collect())
+}
+
+/// Watch_configs arranges for every object `ctl` manages to be reconciled when a ConfigMap or
+/// Secret referenced by its config changes.
+///
+/// The referenced objects are usually not owned by the operator, so they aren't covered by the
+/// controller's owner-reference watches. `get` returns the config for an object. If the Context
+/// has a config selector, only objects matching it are watched.
+pub fn watch_configs<K>(
+    ctl: kube::runtime::Controller<K>,
+    ctx: &Context,
+    get: fn(&K) -> Option<&v1alpha1::ConfigSource>,
+) -> kube::runtime::Controller<K>
+where
+    K: kube::Resource<DynamicType = ()>
+        + Clone
+        + serde::de::DeserializeOwned
+        + std::fmt::Debug
+        + Send
+        + Sync
+        + 'static,
+{
+    use kube::{runtime::reflector::ObjectRef, ResourceExt};
+
+    use self::core::v1::{ConfigMap, Secret};
+
+    let mut wcfg = kube::runtime::watcher::Config::default();
+    if let Some(sel) = &ctx.config_selector {
+        wcfg = wcfg.labels(sel);
+    }
+    let cm_store = ctl.store();
+    let sec_store = ctl.store();
+    ctl.watches(
+        kube::Api::<ConfigMap>::default_namespaced(ctx.client.clone()),
+        wcfg.clone(),
+        move |cm| {
+            let name = cm.name_any();
+            cm_store
+                .state()
+                .iter()
+                .filter(|o| get(o).map(|c| c.uses_config_map(&name)).unwrap_or(false))
+                .map(|o| ObjectRef::from_obj(o.as_ref()))
+                .collect::<Vec<_>>()
+        },
+    )
+    .watches(
+        kube::Api::<Secret>::default_namespaced(ctx.client.clone()),
+        wcfg,
+        move |sec| {
+            let name = sec.name_any();
+            sec_store
+                .state()
+                .iter()
+                .filter(|o| get(o).map(|c| c.uses_secret(&name)).unwrap_or(false))
+                .map(|o| ObjectRef::from_obj(o.as_ref()))
+                .collect::<Vec<_>>()
+        },
+    )
+}
+
+/// Watch_deployments arranges for every object `ctl` manages to be reconciled when the existing
+/// Deployment it names, as reported by `get`, changes.
+pub fn watch_deployments<K>(
+    ctl: kube::runtime::Controller<K>,
+    ctx: &Context,
+    get: fn(&K) -> Option<&String>,
+) -> kube::runtime::Controller<K>
+where
+    K: kube::Resource<DynamicType = ()>
+        + Clone
+        + serde::de::DeserializeOwned
+        + std::fmt::Debug
+        + Send
+        + Sync
+        + 'static,
+{
+    use kube::{runtime::reflector::ObjectRef, ResourceExt};
+
+    use k8s_openapi::api::apps::v1::Deployment;
+
+    let store = ctl.store();
+    ctl.watches(
+        kube::Api::<Deployment>::default_namespaced(ctx.client.clone()),
+        Default::default(),
+        move |d| {
+            let name = d.name_any();
+            store
+                .state()
+                .iter()
+                .filter(|o| get(o) == Some(&name))
+                .map(|o| ObjectRef::from_obj(o.as_ref()))
+                .collect::<Vec<_>>()
+        },
+    )
+}
+
+/// Watch_proxy arranges for every object `ctl` manages to be reconciled when the cluster-wide
+/// Proxy changes, if the cluster serves one.
+pub fn watch_proxy<K>(
+    ctl: kube::runtime::Controller<K>,
+    ctx: &Context,
+) -> kube::runtime::Controller<K>
+where
+    K: kube::Resource<DynamicType = ()>
+        + Clone
+        + serde::de::DeserializeOwned
+        + std::fmt::Debug
+        + Send
+        + Sync
+        + 'static,
+{
+    use kube::runtime::reflector::ObjectRef;
+
+    let ar = match &ctx.proxy {
+        Some(ar) => ar.clone(),
+        None => return ctl,
+    };
+    let store = ctl.store();
+    ctl.watches_with(
+        kube::Api::<kube::api::DynamicObject>::all_with(ctx.client.clone(), &ar),
+        ar,
+        kube::runtime::watcher::Config::default().fields("metadata.name=cluster"),
+        move |_| {
+            store
+                .state()
+                .iter()
+                .map(|o| ObjectRef::from_obj(o.as_ref()))
+                .collect::<Vec<_>>()
+        },
+    )
+}
+
+/// Apply_proxy_env replaces any proxy variables in `env` with the ones in `proxy`.
+pub fn apply_proxy_env(env: &mut Vec<core::v1::EnvVar>, proxy: &[core::v1::EnvVar]) {
+    env.retain(|e| !PROXY_VARS.iter().any(|(_, name)| e.name == *name));
+    env.extend(proxy.iter().cloned());
+}
+
+/// Apply_runtime_env sets GOMAXPROCS and GOMEMLIMIT in `env` from the "clair" container's
+/// `resources`, so the Go runtime keeps within them. Both are removed if `enabled` is false.
+///
+/// GOMEMLIMIT is only set if there's a memory limit, and leaves some headroom below it for memory
+/// the Go runtime doesn't account for.
+pub fn apply_runtime_env(
+    env: &mut Vec<core::v1::EnvVar>,
+    resources: Option<&core::v1::ResourceRequirements>,
+    enabled: bool,
+) {
+    use self::core::v1::{EnvVar, EnvVarSource, ResourceFieldSelector};
+    env.retain(|e| e.name != "GOMAXPROCS" && e.name != "GOMEMLIMIT");
+    if !enabled {
+        return;
+    }
+    env.push(EnvVar {
+        name: "GOMAXPROCS".into(),
+        value: None,
+        value_from: Some(EnvVarSource {
+            resource_field_ref: Some(ResourceFieldSelector {
+                container_name: Some("clair".into()),
+                resource: "requests.cpu".into(),
+                divisor: None,
+            }),
+            ..Default::default()
+        }),
+    });
+    let limit = resources
+        .and_then(|r| r.limits.as_ref())
+        .and_then(|l| l.get("memory"))
+        .and_then(quantity_bytes);
+    if let Some(limit) = limit {
+        env.push(EnvVar {
+            name: "GOMEMLIMIT".into(),
+            value: Some((limit / 10 * 9).to_string()),
+            value_from: None,
+        });
+    }
+}
+
+/// Quantity_bytes converts the memory quantity `q` to bytes.
+///
+/// `None` is returned if `q` can't be parsed.
+fn quantity_bytes(q: &meta::v1::Quantity) -> Option<u64> {
+    let s = q.0.trim();
+    let split = s
+        .find(|c: char| !(c.is_ascii_digit() || c == '.'))
+        .unwrap_or(s.len());
+    let (num, suffix) = s.split_at(split);
+    let num: f64 = num.parse().ok()?;
+    let mult: f64 = match suffix {
+        "" => 1.,
+        "m" => 1e-3,
+        "k" => 1e3,
+        "M" => 1e6,
+        "G" => 1e9,
+        "T" => 1e12,
+        "P" => 1e15,
+        "E" => 1e18,
+        "Ki" => 1024_f64,
+        "Mi" => 1024_f64.powi(2),
+        "Gi" => 1024_f64.powi(3),
+        "Ti" => 1024_f64.powi(4),
+        "Pi" => 1024_f64.powi(5),
+        "Ei" => 1024_f64.powi(6),
+        e if e.starts_with(['e', 'E']) => 10_f64.powi(e[1..].parse().ok()?),
+        _ => return None,
+    };
+    Some((num * mult) as u64)
+}
+
+/// Trusted_ca ensures a ConfigMap that OpenShift injects the cluster's trusted CA bundle into
+/// exists for `obj`, and returns the Volume and VolumeMount to use it.
+///
+/// `None` is returned if the cluster does not serve the Proxy API.
+#[instrument(skip_all)]
+pub async fn trusted_ca<S>(
+    obj: &S,
+    ctx: &Context,
+) -> Result<Option<(core::v1::Volume, core::v1::VolumeMount)>>
+where
+    S: v1alpha1::CrdCommon + v1alpha1::CommonMetadata,
+{
+    use std::collections::BTreeMap;
+
+    use kube::ResourceExt;
+
+    use self::core::v1::{ConfigMap, ConfigMapVolumeSource, KeyToPath, Volume, VolumeMount};
+
+    if ctx.proxy.is_none() {
+        return Ok(None);
+    }
+    let name = format!(
+        "{}-{}-trusted-ca",
+        obj.name_any(),
+        S::kind(&()).to_ascii_lowercase()
+    );
+    let api: kube::Api<ConfigMap> = kube::Api::default_namespaced(ctx.client.clone());
+    if let Some(cm) = api.get_opt(&name).await? {
+        // OpenShift owns the data, so only the metadata is patched.
+        let mut want = cm.clone();
+        if apply_common_metadata(&mut want, obj.common_labels(), obj.common_annotations()) {
+            let patch = serde_json::json!({
+                "metadata": {
+                    "labels": want.labels(),
+                    "annotations": want.annotations(),
+                },
+            });
+            api.patch(
+                &name,
+                &kube::api::PatchParams::default(),
+                &kube::api::Patch::Merge(patch),
+            )
+            .await?;
+            trace!(name, "updated trusted CA ConfigMap metadata");
+        }
+    } else {
+        let mut cm = ConfigMap {
+            metadata: meta::v1::ObjectMeta {
+                name: Some(name.clone()),
+                owner_references: Some(vec![obj
+                    .controller_owner_ref(&())
+                    .expect("unable to create owner ref")]),
+                labels: Some(BTreeMap::from([(
+                    TRUSTED_CA_LABEL.to_string(),
+                    "true".to_string(),
+                )])),
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        apply_common_metadata(&mut cm, obj.common_labels(), obj.common_annotations());
+        api.create(&CREATE_PARAMS, &cm).await?;
+        trace!(name, "created trusted CA ConfigMap");
+    }
+    Ok(Some((
+        Volume {
+            name: "trusted-ca".into(),
+            config_map: Some(ConfigMapVolumeSource {
+                name: Some(name),
+                optional: Some(true),
+                items: Some(vec![KeyToPath {
+                    key: "ca-bundle.crt".into(),
+                    path: "tls-ca-bundle.pem".into(),
+                    mode: None,
+                }]),
+                ..Default::default()
+            }),
+            ..Default::default()
+        },
+        VolumeMount {
+            name: "trusted-ca".into(),
+            mount_path: "/etc/pki/ca-trust/extracted/pem".into(),
+            read_only: Some(true),
+            ..Default::default()
+        },
+    )))
+}
+
+/// Apply_dns sets the DNS settings on the pod spec `pod`, falling back to those of the templated
+/// pod spec `tmpl` for any that aren't set.
+pub fn apply_dns(
+    pod: &mut core::v1::PodSpec,
+    policy: Option<&String>,
+    config: Option<&core::v1::PodDNSConfig>,
+    aliases: &[core::v1::HostAlias],
+    tmpl: Option<&core::v1::PodSpec>,
+) {
+    pod.dns_policy = policy
+        .cloned()
+        .or_else(|| tmpl.and_then(|t| t.dns_policy.clone()));
+    pod.dns_config = config
+        .cloned()
+        .or_else(|| tmpl.and_then(|t| t.dns_config.clone()));
+    pod.host_aliases = if aliases.is_empty() {
+        tmpl.and_then(|t| t.host_aliases.clone())
+    } else {
+        Some(aliases.to_vec())
+    };
+}
+
+/// Apply_rollout sets the fields of `r` on the Deployment spec `spec`, falling back to those of
+/// the templated Deployment spec `tmpl` for any that aren't set.
+pub fn apply_rollout(
+    spec: &mut k8s_openapi::api::apps::v1::DeploymentSpec,
+    r: Option<&v1alpha1::Rollout>,
+    tmpl: Option<&k8s_openapi::api::apps::v1::DeploymentSpec>,
+) {
+    spec.min_ready_seconds = r
+        .and_then(|r| r.min_ready_seconds)
+        .or_else(|| tmpl.and_then(|t| t.min_ready_seconds));
+    spec.progress_deadline_seconds = r
+        .and_then(|r| r.progress_deadline_seconds)
+        .or_else(|| tmpl.and_then(|t| t.progress_deadline_seconds));
+    spec.revision_history_limit = r
+        .and_then(|r| r.revision_history_limit)
+        .or_else(|| tmpl.and_then(|t| t.revision_history_limit));
+}
+
+/// Apply_common_metadata adds `labels` and `annotations` to `obj`, reporting if anything changed.
+///
+/// Keys already present are overwritten, but keys that are no longer requested are left in place,
+/// as there's no way to tell them apart from keys added by some other process.
+pub fn apply_common_metadata<K: kube::Resource>(
+    obj: &mut K,
+    labels: Option<&std::collections::BTreeMap<String, String>>,
+    annotations: Option<&std::collections::BTreeMap<String, String>>,
+) -> bool {
+    apply_common_meta(obj.meta_mut(), labels, annotations)
+}
+
+/// Apply_common_meta is [`apply_common_metadata`] for bare ObjectMeta, such as a pod template's.
+pub fn apply_common_meta(
+    meta: &mut meta::v1::ObjectMeta,
+    labels: Option<&std::collections::BTreeMap<String, String>>,
+    annotations: Option<&std::collections::BTreeMap<String, String>>,
+) -> bool {
+    let mut changed = false;
+    for (want, have) in [
+        (labels, &mut meta.labels),
+        (annotations, &mut meta.annotations),
+    ] {
+        for (k, v) in want.into_iter().flatten() {
+            let have = have.get_or_insert_with(Default::default);
+            if have.get(k) != Some(v) {
+                have.insert(k.clone(), v.clone());
+                changed = true;
+            }
+        }
+    }
+    changed
+}
+
+/// Apply_service_mesh sets the labels and annotations that have `mesh` inject its proxy into pods
+/// created from `tmpl`, removing those of any other mesh.
+pub fn apply_service_mesh(
+    tmpl: &mut core::v1::PodTemplateSpec,
+    mesh: Option<&v1alpha1::ServiceMesh>,
+) {
+    use v1alpha1::ServiceMesh;
+    const ISTIO_LABEL: &str = "sidecar.istio.io/inject";
+    const LINKERD_ANNOTATION: &str = "linkerd.io/inject";
+
+    let meta = tmpl.metadata.get_or_insert_with(Default::default);
+    let labels = meta.labels.get_or_insert_with(Default::default);
+    let annotations = meta.annotations.get_or_insert_with(Default::default);
+    labels.remove(ISTIO_LABEL);
+    annotations.remove(LINKERD_ANNOTATION);
+    match mesh {
+        Some(ServiceMesh::Istio) => {
+            labels.insert(ISTIO_LABEL.into(), "true".into());
+        }
+        Some(ServiceMesh::Linkerd) => {
+            annotations.insert(LINKERD_ANNOTATION.into(), "enabled".into());
+        }
+        None => {}
+    };
+}
+
+/// Apply_hibernate scales `d` to zero if `hibernate` is set, remembering the previous replica count
+/// in an annotation so it can be restored once `hibernate` is unset.
+pub fn apply_hibernate(d: &mut k8s_openapi::api::apps::v1::Deployment, hibernate: bool) {
+    use kube::ResourceExt;
+    let saved = d.annotations().get(HIBERNATE_ANNOTATION.as_str()).cloned();
+    let spec = match d.spec.as_mut() {
+        Some(spec) => spec,
+        None => return,
+    };
+    if hibernate {
+        let prev = spec.replicas.unwrap_or(1);
+        spec.replicas = Some(0);
+        if saved.is_none() {
+            d.annotations_mut()
+                .insert(HIBERNATE_ANNOTATION.to_string(), prev.to_string());
+        }
+    } else if let Some(n) = saved {
+        spec.replicas = Some(n.parse().unwrap_or(1));
+        d.annotations_mut().remove(HIBERNATE_ANNOTATION.as_str());
+    }
+}
+
+/// Rollout_condition returns a "projectclair.io/Degraded" condition for `obj`, reporting whether
+/// the rollout of its Deployment `d` has exceeded its progress deadline.
+pub fn rollout_condition<K>(
+    obj: &K,
+    req: &Request,
+    d: &k8s_openapi::api::apps::v1::Deployment,
+) -> meta::v1::Condition
+where
+    K: kube::Resource,
+{
+    use kube::ResourceExt;
+    let stuck = d
+        .status
+        .as_ref()
+        .and_then(|s| s.conditions.as_ref())
+        .map(|cs| {
+            cs.iter().any(|c| {
+                c.type_ == "Progressing"
+                    && c.status == "False"
+                    && c.reason.as_deref() == Some("ProgressDeadlineExceeded")
+            })
+        })
+        .unwrap_or(false);
+    meta::v1::Condition {
+        last_transition_time: req.now(),
+        observed_generation: obj.meta().generation,
+        type_: clair_condition("Degraded"),
+        status: if stuck { "True" } else { "False" }.into(),
+        reason: if stuck {
+            "ProgressDeadlineExceeded"
+        } else {
+            "RolloutHealthy"
+        }
+        .into(),
+        message: if stuck {
+            format!(
+                "Deployment {:?} exceeded its progress deadline",
+                d.name_any()
+            )
+        } else {
+            String::new()
+        },
+    }
+}
+
+/// Rollout_event returns the Event announcing a change to the condition `cnd` returned by
+/// [`rollout_condition`].
+pub fn rollout_event(cnd: &meta::v1::Condition) -> events::Event {
+    let stuck = cnd.status == "True";
+    events::Event {
+        type_: if stuck {
+            events::EventType::Warning
+        } else {
+            events::EventType::Normal
+        },
+        reason: cnd.reason.clone(),
+        note: Some(if stuck {
+            cnd.message.clone()
+        } else {
+            "Deployment is progressing again".into()
+        }),
+        action: "CheckRollout".into(),
+        secondary: None,
+    }
+}
+
+/// Existing_deployment fetches the user-managed Deployment `name`, making sure its pod template
+/// carries `digest` so config changes still cause a rollout.
+///
+/// `None` is returned if the Deployment doesn't exist.
+pub async fn existing_deployment(
+    ctx: &Context,
+    name: &str,
+    digest: &str,
+) -> Result<Option<k8s_openapi::api::apps::v1::Deployment>> {
+    use kube::api::{Patch, PatchParams};
+    let api: kube::Api<k8s_openapi::api::apps::v1::Deployment> =
+        kube::Api::default_namespaced(ctx.client.clone());
+    let d = match api.get_opt(name).await? {
+        Some(d) => d,
+        None => return Ok(None),
+    };
+    let cur = d
+        .spec
+        .as_ref()
+        .and_then(|s| s.template.metadata.as_ref())
+        .and_then(|m| m.annotations.as_ref())
+        .and_then(|a| a.get(CONFIG_DIGEST_ANNOTATION.as_str()));
+    if cur.map(String::as_str) == Some(digest) {
+        return Ok(Some(d));
+    }
+    trace!(name, digest, "annotating existing Deployment");
+    let patch = serde_json::json!({
+        "spec": { "template": { "metadata": { "annotations": {
+            CONFIG_DIGEST_ANNOTATION.as_str(): digest,
+        }}}}
+    });
+    Ok(Some(
+        api.patch(name, &PatchParams::default(), &Patch::Merge(&patch))
+            .await?,
+    ))
+}
+
+/// Select_deployment points the Service `name` at the pods of the user-managed Deployment
+/// `deployment`, or back at the templated pods if `deployment` is `None`.
+///
+/// Nothing is done if either object doesn't exist yet.
+pub async fn select_deployment(ctx: &Context, name: &str, deployment: Option<&str>) -> Result<()> {
+    let dapi: kube::Api<k8s_openapi::api::apps::v1::Deployment> =
+        kube::Api::default_namespaced(ctx.client.clone());
+    let sapi: kube::Api<core::v1::Service> = kube::Api::default_namespaced(ctx.client.clone());
+    let want = match deployment {
+        Some(deployment) => match dapi.get_opt(deployment).await? {
+            Some(d) => match d.spec.and_then(|s| s.selector.match_labels) {
+                Some(labels) => Some(labels),
+                None => return Ok(()),
+            },
+            None => return Ok(()),
+        },
+        None => None,
+    };
+    let mut srv = match sapi.get_opt(name).await? {
+        Some(s) => s,
+        None => return Ok(()),
+    };
+    if !apply_selector(&mut srv, want) {
+        return Ok(());
+    }
+    trace!(name, deployment, "updating Service selector");
+    sapi.replace(name, &CREATE_PARAMS, &srv).await?;
+    Ok(())
+}
+
+/// Apply_selector sets the selector of `srv` to `want`, remembering the templated selector in an
+/// annotation so it can be restored once `want` is `None`.
+///
+/// Reports whether `srv` was changed.
+pub fn apply_selector(
+    srv: &mut core::v1::Service,
+    want: Option<std::collections::BTreeMap<String, String>>,
+) -> bool {
+    use kube::ResourceExt;
+    let saved = srv.annotations().get(SELECTOR_ANNOTATION.as_str()).cloned();
+    let spec = srv.spec.get_or_insert_with(Default::default);
+    match want {
+        Some(want) => {
+            if spec.selector.as_ref() == Some(&want) && saved.is_some() {
+                return false;
+            }
+            let prev = std::mem::replace(&mut spec.selector, Some(want)).unwrap_or_default();
+            if saved.is_none() {
+                let prev = serde_json::to_string(&prev).expect("map serialization failed");
+                srv.annotations_mut()
+                    .insert(SELECTOR_ANNOTATION.to_string(), prev);
+            }
+        }
+        None => {
+            let saved = match saved {
+                Some(saved) => saved,
+                None => return false,
+            };
+            match serde_json::from_str(&saved) {
+                Ok(sel) => spec.selector = Some(sel),
+                Err(error) => warn!(%error, "unable to restore templated Service selector"),
+            };
+            srv.annotations_mut().remove(SELECTOR_ANNOTATION.as_str());
+        }
+    };
+    true
+}
+
+/// Release_owned deletes the `K` named `name` if `obj` controls it.
+///
+/// This is used to remove templated objects once `obj` has been pointed at an existing
+/// Deployment.
+pub async fn release_owned<S, K>(obj: &S, ctx: &Context, name: &str) -> Result<()>
+where
+    S: v1alpha1::CrdCommon,
+    K: kube::Resource<DynamicType = (), Scope = k8s_openapi::NamespaceResourceScope>
+        + Clone
+        + serde::de::DeserializeOwned
+        + std::fmt::Debug,
+{
+    use kube::{api::DeleteParams, ResourceExt};
+    let api: kube::Api<K> = kube::Api::default_namespaced(ctx.client.clone());
+    let cur = match api.get_opt(name).await? {
+        Some(cur) => cur,
+        None => return Ok(()),
+    };
+    let ours = cur
+        .owner_references()
+        .iter()
+        .any(|r| r.controller == Some(true) && Some(&r.uid) == obj.meta().uid.as_ref());
+    if !ours {
+        return Ok(());
+    }
+    debug!(name, kind = %K::kind(&()), "deleting templated object");
+    api.delete(name, &DeleteParams::background()).await?;
+    Ok(())
+}
+
+/// Resolved_image reports the digest-pinned image the "clair" container of `d`'s pods is running.
+///
+/// `want` is returned as-is if it's already pinned by digest. `None` is returned if no pod is
+/// running `want` yet.
+pub async fn resolved_image(
+    ctx: &Context,
+    d: &k8s_openapi::api::apps::v1::Deployment,
+    want: &str,
+) -> Result<Option<String>> {
+    if want.contains('@') {
+        return Ok(Some(want.to_string()));
+    }
+    let labels = d
+        .spec
+        .as_ref()
+        .and_then(|s| s.selector.match_labels.clone())
+        .unwrap_or_default();
+    if labels.is_empty() {
+        return Ok(None);
+    }
+    let selector = labels
+        .iter()
+        .map(|(k, v)| format!("{k}={v}"))
+        .collect::<Vec<_>>()
+        .join(",");
+    let api: kube::Api<core::v1::Pod> = kube::Api::default_namespaced(ctx.client.clone());
+    let pods = api
+        .list(&kube::api::ListParams::default().labels(&selector))
+        .await?;
+    Ok(pods
+        .items
+        .iter()
+        .filter(|p| {
+            p.spec
+                .as_ref()
+                .map(|s| {
+                    s.containers
+                        .iter()
+                        .any(|c| c.name == "clair" && c.image.as_deref() == Some(want))
+                })
+                .unwrap_or(false)
+        })
+        .filter_map(|p| p.status.as_ref()?.container_statuses.as_ref())
+        .flatten()
+        .filter(|s| s.name == "clair")
+        // Docker-based runtimes report the ID with a scheme prefix.
+        .map(|s| s.image_id.trim_start_matches("docker-pullable://"))
+        .find(|id| id.contains('@'))
+        .map(String::from))
+}
+
 /// Set_component_label sets the component label to `c`.
 pub fn set_component_label(meta: &mut meta::v1::ObjectMeta, c: &str) {
     let mut l = meta.labels.take().unwrap_or_default();
@@ -442,6 +1787,27 @@ lazy_static! {
     ///
     /// TODO(hank): This is actually an annotation.
     pub static ref DROPIN_LABEL: String = clair_label("dropin-key");
+    /// CONFIG_DIGEST_ANNOTATION is an annotation on a Deployment's pod template holding a digest
+    /// of the config the pods were started with.
+    pub static ref CONFIG_DIGEST_ANNOTATION: String = clair_label("config-digest");
+    /// HIBERNATE_ANNOTATION is an annotation on a hibernating Deployment holding the replica count
+    /// to restore.
+    pub static ref HIBERNATE_ANNOTATION: String = clair_label("hibernated-replicas");
+    /// SELECTOR_ANNOTATION is an annotation on a Service pointed at a user-managed Deployment
+    /// holding the templated selector to restore.
+    pub static ref SELECTOR_ANNOTATION: String = clair_label("templated-selector");
+    /// CONFIG_HISTORY_LABEL is a label on config snapshots holding the UID of the object they're
+    /// for.
+    pub static ref CONFIG_HISTORY_LABEL: String = clair_label("config-history");
+    /// CONFIG_ROOT_ANNOTATION is an annotation on config snapshots holding the original key of the
+    /// root config, which is mounted under that name.
+    pub static ref CONFIG_ROOT_ANNOTATION: String = clair_label("config-root");
+    /// ROLLBACK_ANNOTATION is an annotation on an Indexer or Matcher holding the digest, or a
+    /// unique prefix of it, of a config snapshot to run instead of the current config.
+    pub static ref ROLLBACK_ANNOTATION: String = clair_label("rollback-to");
+    /// TRUSTED_CA_LABEL is the label OpenShift uses to find ConfigMaps to inject the cluster's
+    /// trusted CA bundle into.
+    pub static ref TRUSTED_CA_LABEL: String = String::from("config.openshift.io/inject-trusted-cabundle");
 
 
     /// CREATE_PARAMS is default post paramaters.
@@ -455,3 +1821,215 @@ lazy_static! {
 
 /// CONTROLLER_NAME is the name the controller uses whenever it needs a human-readable name.
 pub const CONTROLLER_NAME: &str = "clair-controller";
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn backoff() {
+        let tuning = Tuning {
+            error_requeue: Duration::from_secs(1),
+            max_error_requeue: Duration::from_secs(5),
+            ..Default::default()
+        };
+        let obj = core::v1::ConfigMap {
+            metadata: meta::v1::ObjectMeta {
+                name: Some("test".into()),
+                namespace: Some("default".into()),
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        let b = Backoff::default();
+        let got: Vec<u64> = (0..5).map(|_| b.failed(&obj, &tuning).as_secs()).collect();
+        assert_eq!(got, vec![1, 2, 4, 5, 5]);
+        b.succeeded(&obj);
+        assert_eq!(b.failed(&obj, &tuning), Duration::from_secs(1));
+    }
+
+    #[test]
+    fn selector_byo_and_back() {
+        use std::collections::BTreeMap;
+
+        let templated = BTreeMap::from([("app".to_string(), "clair".to_string())]);
+        let byo = BTreeMap::from([("app".to_string(), "mine".to_string())]);
+        let mut srv = core::v1::Service {
+            spec: Some(core::v1::ServiceSpec {
+                selector: Some(templated.clone()),
+                ..Default::default()
+            }),
+            ..Default::default()
+        };
+        let selector = |srv: &core::v1::Service| srv.spec.as_ref().unwrap().selector.clone();
+        let saved = |srv: &core::v1::Service| {
+            srv.metadata
+                .annotations
+                .as_ref()
+                .and_then(|a| a.get(SELECTOR_ANNOTATION.as_str()).cloned())
+        };
+
+        assert!(apply_selector(&mut srv, Some(byo.clone())));
+        assert_eq!(selector(&srv), Some(byo.clone()));
+        assert!(saved(&srv).is_some());
+        // Reapplying must not overwrite the remembered selector with the user's.
+        assert!(!apply_selector(&mut srv, Some(byo.clone())));
+        assert!(apply_selector(&mut srv, None));
+        assert_eq!(selector(&srv), Some(templated.clone()));
+        assert_eq!(saved(&srv), None);
+        assert!(!apply_selector(&mut srv, None));
+        assert_eq!(selector(&srv), Some(templated));
+    }
+
+    #[test]
+    fn runtime_env() {
+        use std::collections::BTreeMap;
+
+        use self::core::v1::ResourceRequirements;
+        use self::meta::v1::Quantity;
+
+        let gomemlimit = |mem: Option<&str>| {
+            let res = ResourceRequirements {
+                limits: mem.map(|m| BTreeMap::from([("memory".into(), Quantity(m.into()))])),
+                ..Default::default()
+            };
+            let mut env = vec![];
+            apply_runtime_env(&mut env, Some(&res), true);
+            assert!(env.iter().any(|e| e.name == "GOMAXPROCS"));
+            env.into_iter()
+                .find(|e| e.name == "GOMEMLIMIT")
+                .and_then(|e| e.value)
+        };
+        assert_eq!(gomemlimit(None), None);
+        assert_eq!(gomemlimit(Some("1Gi")).as_deref(), Some("966367638"));
+        assert_eq!(gomemlimit(Some("1G")).as_deref(), Some("900000000"));
+        assert_eq!(gomemlimit(Some("1e9")).as_deref(), Some("900000000"));
+        assert_eq!(gomemlimit(Some("lots")), None);
+
+        let mut env = vec![];
+        apply_runtime_env(&mut env, None, false);
+        assert!(env.is_empty());
+    }
+
+    fn snapshot(name: &str, digest: &str) -> core::v1::Secret {
+        use k8s_openapi::ByteString;
+        core::v1::Secret {
+            metadata: meta::v1::ObjectMeta {
+                name: Some(name.into()),
+                annotations: Some(
+                    [
+                        (CONFIG_DIGEST_ANNOTATION.to_string(), digest.into()),
+                        (CONFIG_ROOT_ANNOTATION.to_string(), "config.yaml".into()),
+                    ]
+                    .into(),
+                ),
+                ..Default::default()
+            },
+            data: Some(
+                [
+                    ("config.yaml".into(), ByteString(vec![])),
+                    ("10-dropin.json".into(), ByteString(vec![])),
+                ]
+                .into(),
+            ),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn match_snapshot_prefix() {
+        use kube::ResourceExt;
+
+        let snaps = || {
+            vec![
+                snapshot("a", "0123456789abcdef"),
+                snapshot("b", "01234567ffffffff"),
+            ]
+        };
+        let got = match_snapshot(snaps(), "0123456789").expect("should match");
+        assert_eq!(got.name_any(), "a");
+        let err = match_snapshot(snaps(), "01234567").expect_err("should be ambiguous");
+        assert!(err.contains("more than one"), "{err}");
+        let err = match_snapshot(snaps(), "fedcba98").expect_err("should not match");
+        assert!(err.contains("no config snapshot"), "{err}");
+    }
+
+    #[test]
+    fn snapshot_volumes_colliding_keys() {
+        use k8s_openapi::ByteString;
+
+        // The root config and both dropins share a key, which must not clobber each other.
+        let mut snap = snapshot("snap", "0123456789abcdef");
+        snap.data = Some(
+            [
+                (
+                    snapshot_key(None, "config.yaml"),
+                    ByteString(b"root".to_vec()),
+                ),
+                (
+                    snapshot_key(Some(0), "config.yaml"),
+                    ByteString(b"a".to_vec()),
+                ),
+                (
+                    snapshot_key(Some(1), "config.yaml"),
+                    ByteString(b"b".to_vec()),
+                ),
+            ]
+            .into(),
+        );
+        assert_eq!(snap.data.as_ref().unwrap().len(), 3);
+        let (vols, mounts, filename) = snapshot_volumes(&snap);
+        assert_eq!(filename, "/etc/clair/config.yaml");
+
+        let items = |name: &str| -> Vec<(String, String)> {
+            let v = vols
+                .iter()
+                .find(|v| v.name == name)
+                .expect("missing volume");
+            let sec = v.secret.as_ref().expect("not a Secret volume");
+            sec.items
+                .iter()
+                .flatten()
+                .map(|i| (i.key.clone(), i.path.clone()))
+                .collect()
+        };
+        assert_eq!(
+            items("root-config"),
+            vec![("root.config.yaml".into(), "config.yaml".into())]
+        );
+        assert_eq!(
+            items("dropins"),
+            vec![
+                ("dropin-0.config.yaml".into(), "config.yaml".into()),
+                ("dropin-1.config.yaml".into(), "config.yaml".into()),
+            ]
+        );
+        let root = mounts.iter().find(|m| m.name == "root-config").unwrap();
+        assert_eq!(root.sub_path.as_deref(), Some("config.yaml"));
+    }
+
+    #[test]
+    fn snapshot_volumes_mounts_root_and_dropins() {
+        let (vols, mounts, filename) = snapshot_volumes(&snapshot("snap", "0123456789abcdef"));
+        assert_eq!(filename, "/etc/clair/config.yaml");
+
+        assert_eq!(vols.len(), 2);
+        let items = |name: &str| -> Vec<String> {
+            let v = vols
+                .iter()
+                .find(|v| v.name == name)
+                .expect("missing volume");
+            let sec = v.secret.as_ref().expect("not a Secret volume");
+            assert_eq!(sec.secret_name.as_deref(), Some("snap"));
+            sec.items.iter().flatten().map(|i| i.key.clone()).collect()
+        };
+        assert_eq!(items("root-config"), vec!["config.yaml"]);
+        assert_eq!(items("dropins"), vec!["10-dropin.json"]);
+
+        let root = mounts.iter().find(|m| m.name == "root-config").unwrap();
+        assert_eq!(root.mount_path, "/etc/clair/config.yaml");
+        assert_eq!(root.sub_path.as_deref(), Some("config.yaml"));
+        let dropins = mounts.iter().find(|m| m.name == "dropins").unwrap();
+        assert_eq!(dropins.mount_path, "/etc/clair/config.yaml.d");
+    }
+}
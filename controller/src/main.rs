@@ -1,7 +1,11 @@
 use std::{
     net::SocketAddr,
     path::{Path, PathBuf},
-    sync::Arc,
+    sync::{
+        atomic::{AtomicBool, Ordering},
+        Arc, RwLock,
+    },
+    time::Duration,
 };
 
 use futures::prelude::*;
@@ -30,6 +34,24 @@ fn main() {
                 .long("introspection-bind-address")
                 .help("address to bind for the HTTP introspection server")
                 .default_value("[::]:8089"),
+            Arg::new("otlp")
+                .long("otlp")
+                .help("export tracing spans over OTLP")
+                .long_help(concat!(
+                    "Export tracing spans over OTLP.\n",
+                    "The exporter is configured by the standard OpenTelemetry environment ",
+                    "variables, such as OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_SERVICE_NAME."
+                ))
+                .action(ArgAction::SetTrue),
+            Arg::new("probe_address")
+                .long("health-probe-bind-address")
+                .help("address to bind for the HTTP health probe server")
+                .long_help(concat!(
+                    "Address to bind for the HTTP health probe server.\n",
+                    "\"/healthz\" reports the process is running. \"/readyz\" additionally ",
+                    "requires the webhook server to be serving and the CRDs to be established."
+                ))
+                .default_value("[::]:8081"),
             Arg::new("image")
                 .long("image-clair")
                 .env("RELATED_IMAGE_CLAIR")
@@ -37,9 +59,44 @@ fn main() {
                 .default_value(DEFAULT_IMAGE.to_string()),
             Arg::new("leader_elect")
                 .long("leader-elect")
-                .help("Flag for if leader election is needed. Currently does nothing.")
-                .hide(true)
+                .help("only run controllers while holding the leader election Lease")
+                .long_help(concat!(
+                    "Only run controllers while holding the leader election Lease.\n",
+                    "The webhook server is run regardless, so every replica serves admission ",
+                    "requests."
+                ))
                 .action(ArgAction::SetTrue),
+            Arg::new("leader_election_id")
+                .long("leader-election-id")
+                .help("name of the Lease used for leader election")
+                .default_value("clair-operator-lock"),
+            Arg::new("leader_election_namespace")
+                .long("leader-election-namespace")
+                .help("namespace of the Lease used for leader election, if not the current one"),
+            Arg::new("leader_election_identity")
+                .long("leader-election-identity")
+                .env("POD_NAME")
+                .help("name to hold the leader election Lease under")
+                .long_help(concat!(
+                    "Name to hold the leader election Lease under.\n",
+                    "Defaults to the hostname with a random suffix, as the hostname alone is ",
+                    "shared by pods using the host's network."
+                )),
+            Arg::new("lease_duration")
+                .long("lease-duration")
+                .help("seconds other replicas wait before taking over an un-renewed Lease")
+                .value_parser(clap::value_parser!(u64))
+                .default_value("15"),
+            Arg::new("renew_deadline")
+                .long("renew-deadline")
+                .help("seconds the leader keeps retrying a failed renewal before giving up")
+                .value_parser(clap::value_parser!(u64))
+                .default_value("10"),
+            Arg::new("retry_period")
+                .long("retry-period")
+                .help("seconds between attempts to acquire or renew the Lease")
+                .value_parser(clap::value_parser!(u64))
+                .default_value("2"),
             Arg::new("webhook_address")
                 .long("webhook-bind-address")
                 .help("address to bind for the HTTP webhook server")
@@ -58,6 +115,29 @@ fn main() {
                         .join("k8s-webhook-server/serving-certs")
                         .into_os_string(),
                 ),
+            Arg::new("cert_secret")
+                .long("webhook-cert-secret")
+                .help("Secret to bootstrap self-signed webhook certificates into")
+                .long_help(concat!(
+                    "Secret to bootstrap self-signed webhook certificates into.\n",
+                    "If set, a CA and serving certificate are generated and stored there, written ",
+                    "to `cert-dir`, injected into the webhook configurations, and rotated before ",
+                    "they expire. Leave unset when using cert-manager."
+                )),
+            Arg::new("webhook_service")
+                .long("webhook-service")
+                .help("name of the webhook Service, for bootstrapped certificates")
+                .default_value("clair-webhook-projectclair-io"),
+            Arg::new("cluster_domain")
+                .long("cluster-domain")
+                .help("DNS domain of the cluster, for bootstrapped certificates")
+                .default_value("cluster.local"),
+            Arg::new("webhook_configurations")
+                .long("webhook-configurations")
+                .help("comma-separated webhook configurations to inject bootstrapped CAs into")
+                .value_delimiter(',')
+                .action(ArgAction::Append)
+                .default_value("clair-validate.projectclair.io,clair-mutate.projectclair.io"),
             Arg::new("cert_name")
                 .long("cert-name")
                 .help("file inside `cert-dir` containing the TLS certificate")
@@ -66,16 +146,105 @@ fn main() {
                 .long("key-name")
                 .help("file inside `cert-dir` containing the TLS certificate key")
                 .default_value("tls.key"),
+            Arg::new("debounce")
+                .long("debounce")
+                .help("seconds to wait for further changes to an object before reconciling it")
+                .value_parser(clap::value_parser!(u64))
+                .default_value("0"),
+            Arg::new("error_requeue")
+                .long("error-requeue")
+                .help("seconds to wait before retrying an object that failed to reconcile")
+                .long_help(concat!(
+                    "Seconds to wait before retrying an object that failed to reconcile.\n",
+                    "The wait doubles with every further consecutive failure of the same object, ",
+                    "up to `max-error-requeue`."
+                ))
+                .value_parser(clap::value_parser!(u64))
+                .default_value("1"),
+            Arg::new("max_error_requeue")
+                .long("max-error-requeue")
+                .help("most seconds to wait before retrying an object that keeps failing")
+                .value_parser(clap::value_parser!(u64))
+                .default_value("300"),
+            Arg::new("resync")
+                .long("resync")
+                .help("seconds to wait before reconciling an unchanged object again")
+                .value_parser(clap::value_parser!(u64))
+                .default_value("3600"),
+            Arg::new("config_selector")
+                .long("config-selector")
+                .help("label selector for the ConfigMaps and Secrets watched for config changes")
+                .long_help(concat!(
+                    "Label selector for the ConfigMaps and Secrets watched for config changes.\n",
+                    "By default every ConfigMap and Secret in a watched namespace is watched. In ",
+                    "namespaces with many of them, setting this cuts watch traffic, but configs ",
+                    "not matching it are only re-read on resync."
+                )),
+            Arg::new("concurrency")
+                .long("concurrency")
+                .help("objects each controller reconciles at once, or 0 for no limit")
+                .value_parser(clap::value_parser!(u16))
+                .default_value("0"),
+            Arg::new("watch_namespaces")
+                .long("watch-namespaces")
+                .help("comma-separated namespaces to run controllers in")
+                .long_help(concat!(
+                    "Comma-separated namespaces to run controllers in.\n",
+                    "If not provided, controllers run in the namespace from the kubeconfig or ",
+                    "service account. Every listed namespace must be covered by RBAC; ",
+                    "`cargo xtask rbac` generates namespaced RBAC for them. Watching all ",
+                    "namespaces is not supported."
+                ))
+                .value_delimiter(',')
+                .action(ArgAction::Append),
             Arg::new("controllers")
                 .action(ArgAction::Append)
                 .default_values(["clair", "indexer", "matcher"]),
-        ])]);
+        ])])
+        .subcommand(
+            Command::new("check-config")
+                .about("validate a Clair config and its dropins")
+                .long_about(concat!(
+                    "Validate a Clair config and its dropins.\n",
+                    "This composes the files the same way the validating webhook composes the ",
+                    "referenced ConfigMaps and Secrets, without needing a cluster. The exit ",
+                    "status is non-zero if the config is invalid for any requested mode."
+                ))
+                .args([
+                    Arg::new("config")
+                        .required(true)
+                        .value_hint(ValueHint::FilePath)
+                        .help("root config file, in the dialect indicated by its extension"),
+                    Arg::new("dropins")
+                        .long("dropin")
+                        .short('d')
+                        .value_hint(ValueHint::FilePath)
+                        .help("dropin file, applied as a JSON Patch if named \"*-patch\"")
+                        .action(ArgAction::Append),
+                    Arg::new("modes")
+                        .long("mode")
+                        .help("comma-separated modes to validate for")
+                        .value_parser(["indexer", "matcher", "notifier"])
+                        .value_delimiter(',')
+                        .action(ArgAction::Append)
+                        .default_values(["indexer", "matcher", "notifier"]),
+                    Arg::new("effective")
+                        .long("effective")
+                        .help("also print the config each valid mode runs with, defaults included")
+                        .action(ArgAction::SetTrue),
+                ]),
+        );
 
     if let Err(e) = match cmd.get_matches().subcommand() {
         Some(("run", m)) => match Args::try_from(m) {
             Ok(args) => startup(args),
             Err(e) => Err(Error::from(e)),
         },
+        Some(("check-config", m)) => match check_config(m) {
+            Ok(true) => Ok(()),
+            Ok(false) => process::exit(1),
+            Err(e) => Err(e),
+        },
         _ => unreachable!(),
     } {
         eprintln!("{e}");
@@ -84,13 +253,19 @@ fn main() {
 }
 
 struct Args {
-    _leader_elect: bool,
+    leader: Option<leader::Config>,
+    cert_bootstrap: Option<certs::Config>,
     cert_dir: PathBuf,
     cert_name: String,
+    config_selector: Option<String>,
     controllers: Vec<String>,
     image: String,
     introspection_address: std::net::SocketAddr,
     key_name: String,
+    otlp: bool,
+    probe_address: std::net::SocketAddr,
+    tuning: Tuning,
+    watch_namespaces: Vec<String>,
     webhook_address: std::net::SocketAddr,
 }
 
@@ -105,33 +280,166 @@ impl TryFrom<&clap::ArgMatches> for Args {
                 .get_one::<String>("introspection_address")
                 .unwrap()
                 .parse()?,
-            _leader_elect: m.get_flag("leader_elect"),
+            probe_address: m.get_one::<String>("probe_address").unwrap().parse()?,
+            otlp: m.get_flag("otlp"),
+            leader: m.get_flag("leader_elect").then(|| leader::Config {
+                name: m.get_one::<String>("leader_election_id").unwrap().clone(),
+                namespace: m.get_one::<String>("leader_election_namespace").cloned(),
+                identity: m
+                    .get_one::<String>("leader_election_identity")
+                    .filter(|id| !id.is_empty())
+                    .cloned()
+                    .unwrap_or_else(default_identity),
+                lease_duration: Duration::from_secs(*m.get_one::<u64>("lease_duration").unwrap()),
+                renew_deadline: Duration::from_secs(*m.get_one::<u64>("renew_deadline").unwrap()),
+                retry_period: Duration::from_secs(*m.get_one::<u64>("retry_period").unwrap()),
+            }),
             controllers: m
                 .get_many::<String>("controllers")
                 .unwrap()
                 .map(Clone::clone)
                 .collect(),
+            cert_bootstrap: m.get_one::<String>("cert_secret").map(|secret| {
+                let dir = PathBuf::from(m.get_one::<String>("cert_dir").unwrap());
+                certs::Config {
+                    secret: secret.clone(),
+                    service: m.get_one::<String>("webhook_service").unwrap().clone(),
+                    cluster_domain: m.get_one::<String>("cluster_domain").unwrap().clone(),
+                    webhooks: m
+                        .get_many::<String>("webhook_configurations")
+                        .unwrap_or_default()
+                        .map(Clone::clone)
+                        .collect(),
+                    cert_file: dir.join(m.get_one::<String>("cert_name").unwrap()),
+                    key_file: dir.join(m.get_one::<String>("key_name").unwrap()),
+                }
+            }),
             cert_dir: m.get_one::<String>("cert_dir").unwrap().into(),
             cert_name: m.get_one::<String>("cert_name").unwrap().into(),
             key_name: m.get_one::<String>("key_name").unwrap().into(),
+            config_selector: m.get_one::<String>("config_selector").cloned(),
+            watch_namespaces: m
+                .get_many::<String>("watch_namespaces")
+                .unwrap_or_default()
+                .map(Clone::clone)
+                .collect(),
+            tuning: Tuning {
+                debounce: Duration::from_secs(*m.get_one::<u64>("debounce").unwrap()),
+                error_requeue: Duration::from_secs(*m.get_one::<u64>("error_requeue").unwrap()),
+                max_error_requeue: Duration::from_secs(
+                    *m.get_one::<u64>("max_error_requeue").unwrap(),
+                ),
+                resync: Duration::from_secs(*m.get_one::<u64>("resync").unwrap()),
+                concurrency: *m.get_one::<u16>("concurrency").unwrap(),
+            },
         })
     }
 }
 
 impl Args {
-    fn context(&self, client: kube::Client) -> Arc<Context> {
+    fn context(
+        &self,
+        client: kube::Client,
+        proxy: Option<kube::core::ApiResource>,
+        vpa: Option<kube::core::ApiResource>,
+    ) -> Arc<Context> {
         Arc::new(Context {
             client,
             image: self.image.clone(),
+            proxy,
+            vpa,
+            tuning: self.tuning.clone(),
+            config_selector: self.config_selector.clone(),
+            backoff: Default::default(),
         })
     }
 }
 
+/// Default_identity returns the leader election identity to use if none was provided: the
+/// hostname with a random suffix.
+fn default_identity() -> String {
+    let host = std::env::var("HOSTNAME").unwrap_or_else(|_| "clair-operator".into());
+    let mut buf = [0u8; 4];
+    openssl::rand::rand_bytes(&mut buf).expect("unable to read random bytes");
+    let suffix: String = buf.iter().map(|b| format!("{b:02x}")).collect();
+    format!("{host}_{suffix}")
+}
+
+/// Check_config validates the files named in `m`, printing the results for every requested mode.
+///
+/// Reports whether the config is valid for all of them.
+fn check_config(m: &clap::ArgMatches) -> controller::Result<bool> {
+    use k8s_openapi::api::core::v1::ConfigMap;
+
+    // The Builder takes its inputs as ConfigMap keys, so wrap each file in one keyed by its name.
+    fn load(path: &str) -> controller::Result<(ConfigMap, String)> {
+        let key = Path::new(path)
+            .file_name()
+            .map(|n| n.to_string_lossy().to_string())
+            .ok_or_else(|| Error::BadName(format!("not a file: {path}")))?;
+        let cm = ConfigMap {
+            data: Some([(key.clone(), std::fs::read_to_string(path)?)].into()),
+            ..Default::default()
+        };
+        Ok((cm, key))
+    }
+
+    let (root, key) = load(m.get_one::<String>("config").unwrap())?;
+    let mut b = clair_config::Builder::from_root(&root, key)?;
+    for path in m.get_many::<String>("dropins").unwrap_or_default() {
+        let (cm, key) = load(path)?;
+        b = b.add(cm, key)?;
+    }
+    let p: clair_config::Parts = b.into();
+    // Validation calls into Go on a blocking thread, which needs the multi-threaded runtime.
+    let rt = tokio::runtime::Builder::new_multi_thread()
+        .enable_all()
+        .build()?;
+    let v = rt.block_on(p.validate())?;
+
+    let mut ok = true;
+    for mode in m.get_many::<String>("modes").unwrap() {
+        let res = match mode.as_str() {
+            "indexer" => &v.indexer,
+            "matcher" => &v.matcher,
+            "notifier" => &v.notifier,
+            _ => unreachable!(),
+        };
+        match res {
+            Ok(ws) => {
+                print!("{ws}");
+                if m.get_flag("effective") {
+                    let cfg = rt.block_on(p.defaults(mode))?;
+                    print!("---\n# {mode} mode\n{}", serde_yaml::to_string(&cfg)?);
+                }
+            }
+            Err(err) => {
+                ok = false;
+                println!("invalid ({mode} mode): {err}");
+            }
+        };
+    }
+    Ok(ok)
+}
+
 fn startup(args: Args) -> controller::Result<()> {
     use metrics_exporter_prometheus::PrometheusBuilder;
     use tokio::{runtime, signal};
     use tracing_subscriber::{filter::EnvFilter, prelude::*};
 
+    let rt = runtime::Builder::new_multi_thread().enable_all().build()?;
+    let otlp = args.otlp;
+    let otel = if otlp {
+        // The batch exporter spawns its task onto the current runtime.
+        let _guard = rt.enter();
+        let tracer = opentelemetry_otlp::new_pipeline()
+            .tracing()
+            .with_exporter(opentelemetry_otlp::new_exporter().tonic())
+            .install_batch(opentelemetry_sdk::runtime::Tokio)?;
+        Some(tracing_opentelemetry::layer().with_tracer(tracer))
+    } else {
+        None
+    };
     let env_filter = EnvFilter::try_from_default_env().or_else(|_| EnvFilter::try_new("info"))?;
     let collector = tracing_subscriber::Registry::default()
         .with(env_filter)
@@ -144,22 +452,33 @@ fn startup(args: Args) -> controller::Result<()> {
             None
         } else {
             Some(tracing_subscriber::fmt::layer().json())
-        });
+        })
+        .with(otel);
     tracing::subscriber::set_global_default(collector)?;
     let prom = PrometheusBuilder::new().with_http_listener(args.introspection_address);
 
-    let rt = runtime::Builder::new_multi_thread().enable_all().build()?;
     let token = CancellationToken::new();
     rt.handle().spawn(async move {
         if let Err(e) = prom.install() {
             error!("error setting up prometheus endpoint: {e}");
         }
     });
+    if let Some(cfg) = args.cert_bootstrap.clone() {
+        // This needs to be done before starting the webhook server, which only looks for the
+        // certificate files at startup.
+        let client = rt.block_on(kube::Client::try_default())?;
+        rt.block_on(certs::ensure(&client, &cfg))?;
+        rt.handle().spawn(certs::run(client, cfg, token.clone()));
+    }
     let ctlstop = token.clone();
+    let serving = Arc::new(AtomicBool::new(false));
+    rt.handle()
+        .spawn(probes(args.probe_address, serving.clone(), token.clone()));
     rt.handle().spawn(webhooks(
         args.webhook_address,
         args.cert_dir.join(&args.cert_name),
         args.cert_dir.join(&args.key_name),
+        serving,
         token.clone(),
     ));
     rt.handle().spawn(async move {
@@ -168,7 +487,12 @@ fn startup(args: Args) -> controller::Result<()> {
         }
         token.cancel();
     });
-    rt.block_on(run(args, ctlstop))
+    let res = rt.block_on(run(args, ctlstop));
+    if otlp {
+        // Flush any spans still queued in the exporter.
+        opentelemetry::global::shutdown_tracer_provider();
+    }
+    res
 }
 
 async fn run(args: Args, token: CancellationToken) -> controller::Result<()> {
@@ -180,41 +504,112 @@ async fn run(args: Args, token: CancellationToken) -> controller::Result<()> {
     // sure the caches are used optimally.
 
     info!(image = args.image, "default image set");
-    info!("setup done, starting controllers");
-    let ctx = args.context(client);
-    let mut ctrls = task::JoinSet::new();
-    for name in &args.controllers {
-        let fut = match name.to_lowercase().as_str() {
-            "clair" | "clairs" => clairs::controller(token.clone(), ctx.clone())?,
-            "indexer" | "indexers" => indexers::controller(token.clone(), ctx.clone())?,
-            "matcher" | "matchers" => matchers::controller(token.clone(), ctx.clone())?,
-            "notifier" | "notifiers" => todo!(),
-            "updater" | "updaters" => todo!(),
-            other => {
-                warn!(name = other, "unrecognized controller name, skipping");
-                continue;
-            }
-        };
-        ctrls.spawn(fut);
+    match clair_config::version().await {
+        Ok(version) => info!(version, "validating configs with clair config module"),
+        Err(error) => warn!(%error, "unable to determine clair config module version"),
+    };
+    let proxy = kube::discovery::pinned_kind(&client, &controller::proxy_gvk())
+        .await
+        .ok()
+        .map(|(ar, _)| ar);
+    info!(proxy = proxy.is_some(), "cluster-wide proxy support");
+    let vpa = kube::discovery::pinned_kind(&client, &controller::vpa_gvk())
+        .await
+        .ok()
+        .map(|(ar, _)| ar);
+    info!(vpa = vpa.is_some(), "vertical pod autoscaler support");
+    if args
+        .watch_namespaces
+        .iter()
+        .any(|ns| ns == "all" || ns == "*")
+    {
+        return Err(controller::Error::BadName(
+            "watching all namespaces is not supported, list the namespaces to watch".into(),
+        ));
     }
-    while let Some(res) = ctrls.join_next().await {
-        match res {
-            Err(e) => error!("error starting controller: {e}"),
-            Ok(res) => {
-                if let Err(e) = res {
-                    error!("error from controller: {e}");
-                    token.cancel();
+    let namespaces = if args.watch_namespaces.is_empty() {
+        vec![config.default_namespace.clone()]
+    } else {
+        args.watch_namespaces.clone()
+    };
+
+    loop {
+        // Losing the Lease only cancels this token, stopping the controllers but leaving the
+        // webhook server and probes running until the process is asked to stop.
+        let ctlstop = token.child_token();
+        let lease = match args.leader.clone() {
+            Some(cfg) => {
+                info!(
+                    name = cfg.name,
+                    identity = cfg.identity,
+                    "waiting on leader election"
+                );
+                match leader::acquire(client.clone(), cfg, ctlstop.clone()).await? {
+                    Some(h) => Some(h),
+                    None => return Ok(()),
                 }
             }
+            None => None,
         };
+
+        info!("setup done, starting controllers");
+        let mut ctrls = task::JoinSet::new();
+        for ns in &namespaces {
+            // Controllers only ever use their client's default namespace, so a set of controllers
+            // is started per namespace.
+            let mut config = config.clone();
+            config.default_namespace = ns.clone();
+            let ctx = args.context(
+                kube::client::ClientBuilder::try_from(config)?.build(),
+                proxy.clone(),
+                vpa.clone(),
+            );
+            for name in &args.controllers {
+                let fut = match name.to_lowercase().as_str() {
+                    "clair" | "clairs" => clairs::controller(ctlstop.clone(), ctx.clone())?,
+                    "indexer" | "indexers" => indexers::controller(ctlstop.clone(), ctx.clone())?,
+                    "matcher" | "matchers" => matchers::controller(ctlstop.clone(), ctx.clone())?,
+                    "notifier" | "notifiers" => todo!(),
+                    "updater" | "updaters" => todo!(),
+                    other => {
+                        warn!(name = other, "unrecognized controller name, skipping");
+                        continue;
+                    }
+                };
+                info!(namespace = ns, name, "starting controller");
+                ctrls.spawn(fut);
+            }
+        }
+        while let Some(res) = ctrls.join_next().await {
+            match res {
+                Err(e) => error!("error starting controller: {e}"),
+                Ok(res) => {
+                    if let Err(e) = res {
+                        error!("error from controller: {e}");
+                        token.cancel();
+                    }
+                }
+            };
+        }
+        let lease = match lease {
+            Some(h) => h,
+            None => return Ok(()),
+        };
+        if let Err(e) = lease.await {
+            error!("error releasing lease: {e}");
+        }
+        if token.is_cancelled() {
+            return Ok(());
+        }
+        warn!("lost lease, waiting on leader election again");
     }
-    Ok(())
 }
 
 async fn webhooks<A, Pa, Pb>(
     addr: A,
     certfile: Pa,
     keyfile: Pb,
+    serving: Arc<AtomicBool>,
     cancel: CancellationToken,
 ) -> controller::Result<()>
 where
@@ -237,22 +632,146 @@ where
     info!(%addr, "started webhook server");
     // I can't figure out how to name the listener type such that it's either
     // TryStream<TcpStream> or TryStream<TlsStream<TcpStream>>.
-    if certfile.exists() && keyfile.exists() {
-        let (cert, key) = tokio::join!(tokio::fs::read(certfile), tokio::fs::read(keyfile));
-        let id = native_tls::Identity::from_pkcs8(&cert?, &key?)?;
-        let acceptor = TlsAcceptor::from(native_tls::TlsAcceptor::new(id)?);
+    //
+    // Readiness is only reported once the server is about to accept connections, so a cert that
+    // fails to load never shows up as serving.
+    let res = if certfile.exists() && keyfile.exists() {
+        let acceptor = Arc::new(RwLock::new(load_acceptor(certfile, keyfile).await?));
+        tokio::spawn(reload_acceptor(
+            certfile.to_path_buf(),
+            keyfile.to_path_buf(),
+            acceptor.clone(),
+            cancel.clone(),
+        ));
         let l = l
-            .map_ok(|s| (s, acceptor.clone()))
+            .map_ok(move |s| (s, acceptor.read().unwrap().clone()))
             .and_then(|(s, a)| async move { a.accept(s).await.map_err(Error::from) });
-        Server::builder(accept::from_stream(l))
+        let srv = Server::builder(accept::from_stream(l))
             .serve(app.into_make_service())
-            .with_graceful_shutdown(cancel.cancelled_owned())
-            .await
+            .with_graceful_shutdown(cancel.cancelled_owned());
+        serving.store(true, Ordering::Relaxed);
+        srv.await
     } else {
-        Server::builder(accept::from_stream(l))
+        let srv = Server::builder(accept::from_stream(l))
             .serve(app.into_make_service())
-            .with_graceful_shutdown(cancel.cancelled_owned())
-            .await
+            .with_graceful_shutdown(cancel.cancelled_owned());
+        serving.store(true, Ordering::Relaxed);
+        srv.await
+    };
+    serving.store(false, Ordering::Relaxed);
+    res.map_err(Error::from)
+}
+
+/// Probes serves the "/healthz" and "/readyz" endpoints.
+///
+/// Readiness is reported once `webhook` is set and all the CRDs are established.
+async fn probes<A>(
+    addr: A,
+    webhook: Arc<AtomicBool>,
+    cancel: CancellationToken,
+) -> controller::Result<()>
+where
+    A: Into<SocketAddr>,
+{
+    use axum::{routing::get, Router, Server};
+
+    let addr = addr.into();
+    let client = kube::Client::try_default().await?;
+    let app = Router::new()
+        .route("/healthz", get(|| async { "ok" }))
+        .route("/readyz", get(readyz))
+        .with_state((client, webhook));
+    let srv = Server::try_bind(&addr)?;
+    info!(%addr, "started health probe server");
+    srv.serve(app.into_make_service())
+        .with_graceful_shutdown(cancel.cancelled_owned())
+        .await
+        .map_err(Error::from)
+}
+
+async fn readyz(
+    axum::extract::State((client, webhook)): axum::extract::State<(kube::Client, Arc<AtomicBool>)>,
+) -> (axum::http::StatusCode, String) {
+    use axum::http::StatusCode;
+    if !webhook.load(Ordering::Relaxed) {
+        return (
+            StatusCode::SERVICE_UNAVAILABLE,
+            "webhook server not serving".into(),
+        );
+    }
+    match unestablished_crds(&client).await {
+        Ok(names) if names.is_empty() => (StatusCode::OK, "ok".into()),
+        Ok(names) => (
+            StatusCode::SERVICE_UNAVAILABLE,
+            format!("CRDs not established: {}", names.join(", ")),
+        ),
+        Err(err) => (StatusCode::SERVICE_UNAVAILABLE, err.to_string()),
+    }
+}
+
+/// Unestablished_crds reports the names of the operator's CRDs that aren't established.
+async fn unestablished_crds(client: &kube::Client) -> controller::Result<Vec<&'static str>> {
+    use api::v1alpha1;
+    use k8s_openapi::apiextensions_apiserver::pkg::apis::apiextensions::v1::CustomResourceDefinition;
+    use kube::CustomResourceExt;
+
+    let api: kube::Api<CustomResourceDefinition> = kube::Api::all(client.clone());
+    let mut out = Vec::new();
+    for name in [
+        v1alpha1::Clair::crd_name(),
+        v1alpha1::Indexer::crd_name(),
+        v1alpha1::Matcher::crd_name(),
+        v1alpha1::Notifier::crd_name(),
+        v1alpha1::Updater::crd_name(),
+    ] {
+        let established = api
+            .get_opt(name)
+            .await?
+            .and_then(|crd| crd.status?.conditions)
+            .map(|cs| {
+                cs.iter()
+                    .any(|c| c.type_ == "Established" && c.status == "True")
+            })
+            .unwrap_or(false);
+        if !established {
+            out.push(name);
+        }
+    }
+    Ok(out)
+}
+
+async fn load_acceptor(certfile: &Path, keyfile: &Path) -> controller::Result<TlsAcceptor> {
+    let (cert, key) = tokio::join!(tokio::fs::read(certfile), tokio::fs::read(keyfile));
+    let id = native_tls::Identity::from_pkcs8(&cert?, &key?)?;
+    Ok(TlsAcceptor::from(native_tls::TlsAcceptor::new(id)?))
+}
+
+/// Reload_acceptor swaps in a new TLS acceptor whenever the certificate or key file changes, so
+/// rotated certificates (from cert-manager, for example) are picked up without a restart.
+async fn reload_acceptor(
+    certfile: PathBuf,
+    keyfile: PathBuf,
+    acceptor: Arc<RwLock<TlsAcceptor>>,
+    cancel: CancellationToken,
+) {
+    let modified = |p: &Path| std::fs::metadata(p).and_then(|m| m.modified()).ok();
+    let mut last = (modified(&certfile), modified(&keyfile));
+    loop {
+        tokio::select! {
+            _ = cancel.cancelled() => return,
+            _ = tokio::time::sleep(Duration::from_secs(30)) => {},
+        };
+        let cur = (modified(&certfile), modified(&keyfile));
+        if cur == last {
+            continue;
+        }
+        match load_acceptor(&certfile, &keyfile).await {
+            Ok(a) => {
+                *acceptor.write().unwrap() = a;
+                last = cur;
+                info!("reloaded webhook certificate");
+            }
+            Err(error) => warn!(%error, "unable to reload webhook certificate"),
+        };
     }
-    .map_err(Error::from)
 }
@@ -1,13 +1,12 @@
 //! Matchers holds the controller for the "Matcher" CRD.
 
 use kube::{runtime::controller::Error as CtrlErr, Api};
-use tokio::{
-    signal::unix::{signal, SignalKind},
-    time::Duration,
-};
+use tokio::signal::unix::{signal, SignalKind};
 use tokio_stream::wrappers::SignalStream;
 
-use crate::{clair_condition, prelude::*, COMPONENT_LABEL};
+use crate::{
+    clair_condition, prelude::*, COMPONENT_LABEL, CONFIG_DIGEST_ANNOTATION, ROLLBACK_ANNOTATION,
+};
 
 static COMPONENT: &str = "matcher";
 
@@ -34,28 +33,38 @@ pub fn controller(cancel: CancellationToken, ctx: Arc<Context>) -> Result<Contro
         Api::<autoscaling::v2::HorizontalPodAutoscaler>::default_namespaced(client.clone()),
         ctlcfg.clone(),
     )
-    .owns(Api::<core::v1::Service>::default_namespaced(client), ctlcfg)
-    .reconcile_all_on(sig)
-    .graceful_shutdown_on(cancel.cancelled_owned());
+    .owns(Api::<core::v1::Service>::default_namespaced(client), ctlcfg);
+    let ctl = watch_configs(ctl, &ctx, |obj| obj.spec.config.as_ref());
+    let ctl = watch_deployments(ctl, &ctx, |obj| obj.spec.deployment.as_ref());
+    let ctl = watch_proxy(ctl, &ctx)
+        .with_config(ctx.tuning.controller_config())
+        .reconcile_all_on(sig)
+        .graceful_shutdown_on(cancel.cancelled_owned());
+
+    let limit = ctx.tuning.limiter();
 
     Ok(async move {
         info!("spawning matcher controller");
-        ctl.run(reconcile, handle_error, ctx)
-            .for_each(|ret| {
-                match ret {
-                    Ok(_) => (),
-                    Err(err) => match err {
-                        CtrlErr::ObjectNotFound(objref) => error!(%objref, "object not found"),
-                        CtrlErr::ReconcilerFailed(error, objref) => {
-                            error!(%objref, %error, "reconcile error")
-                        }
-                        CtrlErr::QueueError(error) => error!(%error, "queue error"),
-                        CtrlErr::RunnerError(error) => error!(%error, "runner error"),
-                    },
-                };
-                futures::future::ready(())
-            })
-            .await;
+        ctl.run(
+            |obj, ctx| limited(limit.clone(), measure(COMPONENT, reconcile(obj, ctx))),
+            handle_error,
+            ctx,
+        )
+        .for_each(|ret| {
+            match ret {
+                Ok(_) => (),
+                Err(err) => match err {
+                    CtrlErr::ObjectNotFound(objref) => error!(%objref, "object not found"),
+                    CtrlErr::ReconcilerFailed(error, objref) => {
+                        error!(%objref, %error, "reconcile error")
+                    }
+                    CtrlErr::QueueError(error) => error!(%error, "queue error"),
+                    CtrlErr::RunnerError(error) => error!(%error, "runner error"),
+                },
+            };
+            futures::future::ready(())
+        })
+        .await;
         debug!("matcher controller finished");
         Ok(())
     }
@@ -87,7 +96,7 @@ async fn reconcile(obj: Arc<v1alpha1::Matcher>, ctx: Arc<Context>) -> Result<Act
             action,
             secondary: None,
         })
-        .await?;
+        .await;
         next.add_condition(Condition {
             last_transition_time: req.now(),
             message: "\"/spec/config\" missing".into(),
@@ -101,7 +110,7 @@ async fn reconcile(obj: Arc<v1alpha1::Matcher>, ctx: Arc<Context>) -> Result<Act
     trace!("configsource ok");
     trace!(
         provided = spec.image.is_some(),
-        image = spec.image_default(&crate::DEFAULT_IMAGE),
+        image = spec.image_default(&ctx.image),
         "image check"
     );
     next.add_condition(Condition {
@@ -135,6 +144,7 @@ $(
         check_deployment,
         check_service,
         check_hpa,
+        check_vpa,
         check_creation
     );
 
@@ -143,8 +153,8 @@ $(
 }
 
 #[instrument(skip_all)]
-fn handle_error(_obj: Arc<v1alpha1::Matcher>, _err: &Error, _ctx: Arc<Context>) -> Action {
-    Action::await_change()
+fn handle_error(obj: Arc<v1alpha1::Matcher>, _err: &Error, ctx: Arc<Context>) -> Action {
+    Action::requeue(ctx.backoff.failed(obj.as_ref(), &ctx.tuning))
 }
 
 #[instrument(skip_all)]
@@ -161,10 +171,10 @@ async fn publish(
     let mut cur = None;
     let mut c = v1alpha1::Matcher::new(&name, Default::default());
     c.status = Some(next);
+    c.metadata.resource_version = Some(prev.clone());
     let mut ct = 0;
 
     while ct < 3 {
-        c.metadata.resource_version = Some(prev.clone());
         ct += 1;
         let buf = serde_json::to_vec(&c)?;
         match api.replace_status(&name, &CREATE_PARAMS, buf).await {
@@ -172,22 +182,32 @@ async fn publish(
                 cur = c.resource_version();
                 break;
             }
+            // Something else wrote the object since it was read. The status is computed entirely
+            // by this reconcile, so it's written over the newer version rather than discarding
+            // the work done so far.
+            Err(kube::Error::Api(err)) if err.code == 409 => {
+                debug!(attempt = ct, "status conflict, retrying");
+                c.metadata.resource_version = api.get_status(&name).await?.resource_version();
+            }
             Err(err) => error!(error=%err, "problem updating status"),
         }
     }
 
     if let Some(cur) = cur {
         debug!(attempt = ct, prev, cur, "published status");
+        ctx.backoff.succeeded(obj.as_ref());
         if cur == prev {
             // If there was no change, queue out in the future.
-            Ok(Action::requeue(Duration::from_secs(3600)))
+            Ok(Action::requeue(ctx.tuning.resync))
         } else {
             // Handled, so discard the event.
             Ok(Action::await_change())
         }
     } else {
         // Unable to update, so requeue soon.
-        Ok(Action::requeue(Duration::from_secs(5)))
+        Ok(Action::requeue(
+            ctx.backoff.failed(obj.as_ref(), &ctx.tuning),
+        ))
     }
 }
 
@@ -195,7 +215,7 @@ async fn publish(
 async fn check_config(
     obj: &v1alpha1::Matcher,
     _ctx: &Context,
-    _req: &Request,
+    req: &Request,
     next: &mut v1alpha1::MatcherStatus,
 ) -> Result<bool> {
     if obj.status.is_none() || obj.status.as_ref().unwrap().config.is_none() {
@@ -205,6 +225,14 @@ async fn check_config(
     let want = obj.spec.config.as_ref().unwrap();
     let got = obj.status.as_ref().unwrap().config.as_ref().unwrap();
     if got != want {
+        req.publish(Event {
+            type_: EventType::Normal,
+            reason: "ConfigChanged".into(),
+            note: Some("\"/spec/config\" differs from \"/status/config\"".into()),
+            action: "CheckConfig".into(),
+            secondary: None,
+        })
+        .await;
         next.config = obj.spec.config.clone();
         // TODO(hank) Touch the deployment
         return Ok(false);
@@ -215,7 +243,7 @@ async fn check_config(
 async fn check_deployment(
     obj: &v1alpha1::Matcher,
     ctx: &Context,
-    _req: &Request,
+    req: &Request,
     next: &mut v1alpha1::MatcherStatus,
 ) -> Result<bool> {
     use self::core::v1::EnvVar;
@@ -240,22 +268,113 @@ async fn check_deployment(
         .ok_or(Error::BadName("missing needed spec field: config".into()))?;
     trace!("have configsource");
     let api = Api::<apps::v1::Deployment>::default_namespaced(ctx.client.clone());
-    let want_image = obj.spec.image_default(&crate::DEFAULT_IMAGE);
+    let want_image = obj.spec.image_default(&ctx.image);
+    let digest = config_digest(&ctx.client, cfgsrc).await?;
+    trace!(digest, "config digest");
+    if let Some(name) = &obj.spec.deployment {
+        // Switching to an existing Deployment leaves the templated one behind, so remove it.
+        let templated = obj
+            .status
+            .as_ref()
+            .and_then(|s| s.has_ref::<apps::v1::Deployment>())
+            .filter(|r| &r.name != name);
+        if let Some(r) = templated {
+            release_owned::<_, apps::v1::Deployment>(obj, ctx, &r.name).await?;
+            next.remove_ref::<apps::v1::Deployment>();
+        }
+        let d = match existing_deployment(ctx, name, &digest).await? {
+            Some(d) => d,
+            None => {
+                warn!(name, "Deployment not found");
+                return Ok(false);
+            }
+        };
+        let image = d
+            .spec
+            .as_ref()
+            .and_then(|s| s.template.spec.as_ref())
+            .and_then(|s| s.containers.iter().find(|c| c.name == "clair"))
+            .and_then(|c| c.image.clone())
+            .unwrap_or(want_image);
+        next.add_ref(&d);
+        let cnd = rollout_condition(obj, req, &d);
+        req.transitioned(&next.conditions, &cnd, rollout_event(&cnd))
+            .await;
+        next.add_condition(cnd);
+        next.image = resolved_image(ctx, &d, &image).await?;
+        return Ok(true);
+    }
+    let rollback = obj.annotations().get(ROLLBACK_ANNOTATION.as_str()).cloned();
+    if let Some(keep) = obj.spec.config_history.filter(|n| *n > 0) {
+        snapshot_config(obj, ctx, cfgsrc, &digest, keep.into(), rollback.as_deref()).await?;
+    }
+    let snapshot = match &rollback {
+        Some(want) => match find_snapshot(obj, ctx, want).await? {
+            Ok(snap) => Some(snap),
+            Err(note) => {
+                req.publish(Event {
+                    type_: EventType::Warning,
+                    reason: "Rollback".into(),
+                    note: Some(note),
+                    action: "ReconcileConfig".into(),
+                    secondary: None,
+                })
+                .await;
+                return Ok(false);
+            }
+        },
+        None => None,
+    };
+    // Running a snapshot means running its digest, so switching to or from it causes a rollout.
+    let digest = snapshot
+        .as_ref()
+        .and_then(|s| {
+            s.annotations()
+                .get(CONFIG_DIGEST_ANNOTATION.as_str())
+                .cloned()
+        })
+        .unwrap_or(digest);
+    let proxy = proxy_env(ctx).await?;
+    let trusted = trusted_ca(obj, ctx).await?;
+    // The template supplies the values for any tuning that's been removed from the spec. It's
+    // only rendered once per process, so this is cheap on steady-state reconciles.
+    let tmpl: apps::v1::Deployment = new_templated(obj, ctx).await?;
 
     let mut ct = 0;
     while ct < 3 {
         ct += 1;
         trace!(ct, "reconcile attempt");
+        let mut created = false;
         let mut entry = api.entry(&name).await?.or_insert(|| {
             trace!(ct, name, "creating");
+            created = true;
             futures::executor::block_on(new_templated(obj, ctx)).expect("template failed")
         });
         let d = entry.get_mut();
+        if !adopt(obj, d) {
+            return Err(Error::BadName(format!(
+                "Deployment {name:?} is controlled by another object"
+            )));
+        }
         trace!("checking deployment");
+        apply_common_metadata(
+            d,
+            obj.spec.common_labels.as_ref(),
+            obj.spec.common_annotations.as_ref(),
+        );
         d.labels_mut()
             .insert(COMPONENT_LABEL.to_string(), COMPONENT.into());
-        let (mut vols, mut mounts, config) = make_volumes(cfgsrc);
+        apply_hibernate(d, obj.spec.hibernate.unwrap_or(false));
+        let (mut vols, mut mounts, config) = match &snapshot {
+            Some(snap) => snapshot_volumes(snap),
+            None => make_volumes(cfgsrc),
+        };
+        if let Some((v, m)) = trusted.clone() {
+            vols.push(v);
+            mounts.push(m);
+        }
         if let Some(ref mut spec) = d.spec {
+            apply_rollout(spec, obj.spec.rollout.as_ref(), tmpl.spec.as_ref());
             if spec.selector.match_labels.is_none() {
                 spec.selector.match_labels = Some(Default::default());
             }
@@ -265,6 +384,11 @@ async fn check_deployment(
                 .unwrap()
                 .insert(COMPONENT_LABEL.to_string(), COMPONENT.into());
             if let Some(ref mut meta) = spec.template.metadata {
+                apply_common_meta(
+                    meta,
+                    obj.spec.common_labels.as_ref(),
+                    obj.spec.common_annotations.as_ref(),
+                );
                 if meta.labels.is_none() {
                     meta.labels = Some(Default::default());
                 }
@@ -272,8 +396,21 @@ async fn check_deployment(
                     .as_mut()
                     .unwrap()
                     .insert(COMPONENT_LABEL.to_string(), COMPONENT.into());
+                // Clair only reads its config at startup, so changing this annotation is what
+                // causes a rollout when the config changes.
+                meta.annotations
+                    .get_or_insert_with(Default::default)
+                    .insert(CONFIG_DIGEST_ANNOTATION.to_string(), digest.clone());
             }
+            apply_service_mesh(&mut spec.template, obj.spec.service_mesh.as_ref());
             if let Some(ref mut spec) = spec.template.spec {
+                apply_dns(
+                    spec,
+                    obj.spec.dns_policy.as_ref(),
+                    obj.spec.dns_config.as_ref(),
+                    &obj.spec.host_aliases,
+                    tmpl.spec.as_ref().and_then(|s| s.template.spec.as_ref()),
+                );
                 if let Some(ref mut vs) = spec.volumes {
                     vols.append(vs);
                     vols.sort_by_key(|v| v.name.clone());
@@ -304,6 +441,12 @@ async fn check_deployment(
                             value: Some(v1alpha1::Matcher::kind(&()).to_ascii_lowercase()),
                             value_from: None,
                         });
+                        apply_proxy_env(es, &proxy);
+                        apply_runtime_env(
+                            es,
+                            c.resources.as_ref(),
+                            obj.spec.runtime_env.unwrap_or(true),
+                        );
                         es.sort_by_key(|e| e.name.clone());
                         es.dedup_by_key(|e| e.name.clone());
                     };
@@ -313,7 +456,17 @@ async fn check_deployment(
         };
         next.add_ref(d);
         match entry.commit(&CREATE_PARAMS).await {
-            Ok(()) => break,
+            Ok(()) => {
+                if created {
+                    req.created(entry.get()).await;
+                }
+                let cnd = rollout_condition(obj, req, entry.get());
+                req.transitioned(&next.conditions, &cnd, rollout_event(&cnd))
+                    .await;
+                next.add_condition(cnd);
+                next.image = resolved_image(ctx, entry.get(), &want_image).await?;
+                break;
+            }
             Err(err) => {
                 trace!(error = ?err, "commit error");
                 match err {
@@ -333,7 +486,7 @@ async fn check_deployment(
 async fn check_service(
     obj: &v1alpha1::Matcher,
     ctx: &Context,
-    _req: &Request,
+    req: &Request,
     next: &mut v1alpha1::MatcherStatus,
 ) -> Result<bool> {
     let sref = obj
@@ -341,38 +494,109 @@ async fn check_service(
         .as_ref()
         .and_then(|s| s.has_ref::<core::v1::Service>());
     if sref.is_none() {
-        let srv: core::v1::Service = new_templated(obj, ctx).await?;
-        let api = Api::<core::v1::Service>::default_namespaced(ctx.client.clone());
-        let srv = api.create(&CREATE_PARAMS, &srv).await?;
-        debug!(name = srv.name_unchecked(), "created Service");
+        let (srv, created) = create_or_adopt::<_, core::v1::Service>(obj, ctx).await?;
+        if created {
+            debug!(name = srv.name_unchecked(), "created Service");
+            req.created(&srv).await;
+        } else {
+            debug!(name = srv.name_unchecked(), "adopted Service");
+        }
         next.add_ref(&srv);
         return Ok(false);
     }
     // TODO
-    Ok(true)
+    let name = sref.unwrap().name;
+    select_deployment(ctx, &name, obj.spec.deployment.as_deref()).await?;
+    check_common_metadata::<core::v1::Service>(obj, ctx, &name).await
 }
 
 #[instrument(skip_all)]
 async fn check_hpa(
     obj: &v1alpha1::Matcher,
     ctx: &Context,
-    _req: &Request,
+    req: &Request,
     next: &mut v1alpha1::MatcherStatus,
 ) -> Result<bool> {
+    if obj.spec.deployment.is_some() {
+        // An existing Deployment is scaled by its owner, so drop any HPA aimed at the templated one.
+        if let Some(r) = next.has_ref::<autoscaling::v2::HorizontalPodAutoscaler>() {
+            release_owned::<_, autoscaling::v2::HorizontalPodAutoscaler>(obj, ctx, &r.name).await?;
+            next.remove_ref::<autoscaling::v2::HorizontalPodAutoscaler>();
+        }
+        return Ok(true);
+    }
     let href = obj
         .status
         .as_ref()
         .and_then(|s| s.has_ref::<autoscaling::v2::HorizontalPodAutoscaler>());
     if href.is_none() {
-        let hpa: autoscaling::v2::HorizontalPodAutoscaler = new_templated(obj, ctx).await?;
-        let api =
-            Api::<autoscaling::v2::HorizontalPodAutoscaler>::default_namespaced(ctx.client.clone());
-        let hpa = api.create(&CREATE_PARAMS, &hpa).await?;
-        debug!(name = hpa.name_unchecked(), "created HPA");
+        let (hpa, created) =
+            create_or_adopt::<_, autoscaling::v2::HorizontalPodAutoscaler>(obj, ctx).await?;
+        if created {
+            debug!(name = hpa.name_unchecked(), "created HPA");
+            req.created(&hpa).await;
+        } else {
+            debug!(name = hpa.name_unchecked(), "adopted HPA");
+        }
         next.add_ref(&hpa);
         return Ok(false);
     }
     // TODO
+    check_common_metadata::<autoscaling::v2::HorizontalPodAutoscaler>(obj, ctx, &href.unwrap().name)
+        .await
+}
+
+/// Check_common_metadata makes sure the named object carries the Matcher's common labels and
+/// annotations.
+async fn check_common_metadata<K>(
+    obj: &v1alpha1::Matcher,
+    ctx: &Context,
+    name: &str,
+) -> Result<bool>
+where
+    K: Resource<DynamicType = (), Scope = k8s_openapi::NamespaceResourceScope>
+        + Clone
+        + serde::de::DeserializeOwned
+        + serde::Serialize
+        + std::fmt::Debug,
+{
+    let api = Api::<K>::default_namespaced(ctx.client.clone());
+    let mut cur = match api.get_opt(name).await? {
+        Some(cur) => cur,
+        None => return Ok(false),
+    };
+    if apply_common_metadata(
+        &mut cur,
+        obj.spec.common_labels.as_ref(),
+        obj.spec.common_annotations.as_ref(),
+    ) {
+        trace!(name, "updating common metadata");
+        api.replace(name, &CREATE_PARAMS, &cur).await?;
+    }
+    Ok(true)
+}
+
+#[instrument(skip_all)]
+async fn check_vpa(
+    obj: &v1alpha1::Matcher,
+    ctx: &Context,
+    _req: &Request,
+    next: &mut v1alpha1::MatcherStatus,
+) -> Result<bool> {
+    if let Some(name) = &obj.spec.deployment {
+        // Likewise for VPAs: remove any this object created, for either Deployment.
+        let templated = format!(
+            "{}-{}",
+            obj.name_any(),
+            v1alpha1::Matcher::kind(&()).to_ascii_lowercase()
+        );
+        ensure_vpa(obj, ctx, &templated, None).await?;
+        ensure_vpa(obj, ctx, name, None).await?;
+        return Ok(true);
+    }
+    if let Some(dref) = next.has_ref::<apps::v1::Deployment>() {
+        ensure_vpa(obj, ctx, &dref.name, obj.spec.vertical_autoscaling).await?;
+    }
     Ok(true)
 }
 
@@ -383,18 +607,24 @@ async fn check_creation(
     req: &Request,
     next: &mut v1alpha1::MatcherStatus,
 ) -> Result<bool> {
-    let refs = [
+    let mut refs = vec![
         obj.status
             .as_ref()
             .and_then(|s| s.has_ref::<apps::v1::Deployment>()),
         obj.status
             .as_ref()
             .and_then(|s| s.has_ref::<core::v1::Service>()),
-        obj.status
-            .as_ref()
-            .and_then(|s| s.has_ref::<autoscaling::v2::HorizontalPodAutoscaler>()),
     ];
+    // There's no HPA for an existing Deployment.
+    if obj.spec.deployment.is_none() {
+        refs.push(
+            obj.status
+                .as_ref()
+                .and_then(|s| s.has_ref::<autoscaling::v2::HorizontalPodAutoscaler>()),
+        );
+    }
     let ok = refs.iter().all(|r| r.is_some());
+    record_initialized(obj, ok);
     let status = if ok { "True" } else { "False" }.to_string();
     let message = if ok {
         "".to_string()
@@ -424,7 +654,7 @@ async fn check_creation(
             action: "ObjectCreation".into(),
             secondary: None,
         })
-        .await?;
+        .await;
     }
     Ok(ok)
 }
@@ -3,11 +3,11 @@
 // Comment the above and run clippy when touching this file.
 // The iftree macro doesn't allow the "missing_docs" lint by default.
 
-use std::{borrow::Cow, collections::HashMap};
+use std::{borrow::Cow, collections::HashMap, sync::Mutex};
 
 use k8s_openapi::serde;
 use lazy_static::lazy_static;
-use tracing::trace;
+use tracing::{instrument, trace};
 
 // TODO(hank) Set up compile-time compression for these assets.
 // TODO(hank) Implment a macro that disables the doc warnings.
@@ -55,6 +55,10 @@ lazy_static! {
             })
             .collect()
     };
+    /// RENDERED holds every template rendered so far, keyed by its patch file.
+    ///
+    /// Templates don't change once the process has started, so each is only rendered once.
+    static ref RENDERED: Mutex<HashMap<String, serde_json::Value>> = Default::default();
 }
 
 /// DynError is an alias for any error.
@@ -67,6 +71,10 @@ const FROM_DISK: bool = true;
 const FROM_DISK: bool = false;
 
 /// Resource_for returns a templated `K` for the provided "kind" of CRD.
+///
+/// The rendered template is cached, so only the first call for a given `K` and "kind" does any
+/// rendering.
+#[instrument(skip_all, fields(kind = kind.as_ref(), template = %K::kind(&())))]
 pub async fn resource_for<S, K>(kind: S) -> Result<K, DynError>
 where
     S: AsRef<str>,
@@ -74,9 +82,15 @@ where
 {
     use json_patch::Patch;
     use serde_json::Value;
+    let start = std::time::Instant::now();
     let kn = K::kind(&()).to_ascii_lowercase();
     let base_file = format!("{kn}.yaml");
     let patch_file = format!("{kn}-{}.yaml-patch", kind.as_ref());
+    let cached = RENDERED.lock().unwrap().get(&patch_file).cloned();
+    if let Some(doc) = cached {
+        trace!(patch_file, "using rendered template");
+        return serde_json::from_value(doc).map_err(|err| err.into());
+    }
     trace!(
         base_file,
         patch_file,
@@ -96,6 +110,12 @@ where
         trace!("found patch");
         json_patch::patch(&mut doc, patch)?;
     }
+    metrics::histogram!(
+        "clair_operator_template_render_seconds",
+        start.elapsed().as_secs_f64(),
+        "template" => kn
+    );
+    RENDERED.lock().unwrap().insert(patch_file, doc.clone());
     serde_json::from_value(doc).map_err(|err| err.into())
 }
 
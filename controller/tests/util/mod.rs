@@ -15,6 +15,11 @@ pub async fn test_context() -> Arc<Context> {
     Arc::new(Context {
         client,
         image: DEFAULT_IMAGE.clone(),
+        proxy: None,
+        vpa: None,
+        tuning: Default::default(),
+        config_selector: None,
+        backoff: Default::default(),
     })
 }
 
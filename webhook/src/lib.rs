@@ -149,21 +149,6 @@ async fn validate_v1alpha1(
     }
 }
 
-enum Either {
-    ConfigMap(core::v1::ConfigMap),
-    Secret(core::v1::Secret),
-}
-impl From<core::v1::ConfigMap> for Either {
-    fn from(value: core::v1::ConfigMap) -> Self {
-        Self::ConfigMap(value)
-    }
-}
-impl From<core::v1::Secret> for Either {
-    fn from(value: core::v1::Secret) -> Self {
-        Self::Secret(value)
-    }
-}
-
 #[instrument(skip_all)]
 async fn validate_v1alpha1_clair(
     srv: Arc<State>,
@@ -210,6 +195,27 @@ async fn validate_v1alpha1_clair(
             }
         }
         trace!(op = ?req.operation, "dropins OK");
+        if let Some(endpoint) = &spec.endpoint {
+            if endpoint.external_dns.is_some() && endpoint.hostname.is_none() {
+                trace!(op = ?req.operation, "endpoint misconfigured");
+                return Ok(Json(
+                    res.deny("field \"/spec/endpoint/externalDns\" is set but \"/spec/endpoint/hostname\" is not")
+                        .into_review(),
+                ));
+            }
+            if let Some(ttl) = endpoint.external_dns.as_ref().and_then(|d| d.ttl) {
+                if ttl <= 0 {
+                    trace!(op = ?req.operation, ttl, "endpoint misconfigured");
+                    return Ok(Json(
+                        res.deny(format!(
+                            "field \"/spec/endpoint/externalDns/ttl\" must be positive, got {ttl}"
+                        ))
+                        .into_review(),
+                    ));
+                }
+            }
+        }
+        trace!(op = ?req.operation, "endpoint OK");
     }
 
     if req.operation == Operation::Update {
@@ -223,8 +229,18 @@ async fn validate_v1alpha1_clair(
         }
     }
 
-    let cm_api: Api<core::v1::ConfigMap> = Api::default_namespaced(srv.client.clone());
-    let sec_api: Api<core::v1::Secret> = Api::default_namespaced(srv.client.clone());
+    // The referenced configs live alongside the object being admitted.
+    let (cm_api, sec_api): (Api<core::v1::ConfigMap>, Api<core::v1::Secret>) =
+        match req.namespace.as_deref() {
+            Some(ns) => (
+                Api::namespaced(srv.client.clone(), ns),
+                Api::namespaced(srv.client.clone(), ns),
+            ),
+            None => (
+                Api::default_namespaced(srv.client.clone()),
+                Api::default_namespaced(srv.client.clone()),
+            ),
+        };
 
     let cfgsrc = cur.spec.with_root(format!("{}-config", cur.name_any()));
     let root = match cm_api.get_opt(&cfgsrc.root.name).await {
@@ -232,7 +248,10 @@ async fn validate_v1alpha1_clair(
         Err(err) => return Ok(Json(AdmissionResponse::invalid(err).into_review())),
     };
     let root = if root.is_none() {
-        return Ok(Json(res.deny("no such config: {name}").into_review()));
+        let name = &cfgsrc.root.name;
+        return Ok(Json(
+            res.deny(format!("no such config: {name}")).into_review(),
+        ));
     } else {
         root.unwrap()
     };
@@ -250,9 +269,11 @@ async fn validate_v1alpha1_clair(
                 Err(err) => return Ok(Json(AdmissionResponse::invalid(err).into_review())),
             };
             if m.is_none() {
-                return Ok(Json(res.deny("no such config: {name}").into_review()));
+                return Ok(Json(
+                    res.deny(format!("no such config: {name}")).into_review(),
+                ));
             };
-            ds.push((Either::from(m.unwrap()), &r.key));
+            ds.push((clair_config::ConfigObject::from(m.unwrap()), &r.key));
         } else if let Some(r) = &d.secret_key_ref {
             let name = &r.name;
             let m = match sec_api.get_opt(name).await {
@@ -260,18 +281,17 @@ async fn validate_v1alpha1_clair(
                 Err(err) => return Ok(Json(AdmissionResponse::invalid(err).into_review())),
             };
             if m.is_none() {
-                return Ok(Json(res.deny("no such config: {name}").into_review()));
+                return Ok(Json(
+                    res.deny(format!("no such config: {name}")).into_review(),
+                ));
             };
-            ds.push((Either::from(m.unwrap()), &r.key));
+            ds.push((clair_config::ConfigObject::from(m.unwrap()), &r.key));
         } else {
             unreachable!()
         }
     }
     for (d, key) in ds {
-        b = match match d {
-            Either::ConfigMap(v) => b.add(v, key),
-            Either::Secret(v) => b.add(v, key),
-        } {
+        b = match b.add(d, key) {
             Ok(b) => b,
             Err(err) => return Ok(Json(AdmissionResponse::invalid(err).into_review())),
         };
@@ -285,19 +305,28 @@ async fn validate_v1alpha1_clair(
             return Err(StatusCode::INTERNAL_SERVER_ERROR);
         }
     };
-    let to_check = [&v.indexer, &v.matcher, &v.notifier, &v.updater];
+    // Only the modes this Clair actually runs matter: a config that's fine for every deployed
+    // component shouldn't collect errors for the others.
+    let mut to_check = vec![&v.indexer, &v.matcher];
+    if cur.spec.notifier == Some(true) {
+        to_check.push(&v.notifier);
+    }
+    // Lints don't make the config invalid, but are worth showing to whoever applied it. They're
+    // the same for every mode, so they're collected once instead of from each validation.
+    let mut warn = match p.lint().await {
+        Ok(ws) => ws.lints().map(String::from).collect(),
+        Err(err) => {
+            debug!(error = %err, "unable to lint config");
+            Vec::new()
+        }
+    };
     let mut errd = 0;
-    let warn = to_check
-        .iter()
-        .filter_map(|r| {
-            if let Err(err) = r {
-                errd += 1;
-                Some(format!("{err}"))
-            } else {
-                None
-            }
-        })
-        .collect::<Vec<_>>();
+    for r in to_check.iter() {
+        if let Err(err) = r {
+            errd += 1;
+            warn.push(format!("{err}"));
+        }
+    }
     if !warn.is_empty() {
         res.warnings = Some(warn);
     }
@@ -313,7 +342,7 @@ async fn validate_v1alpha1_clair(
 }
 #[instrument(skip_all)]
 async fn validate_v1alpha1_indexer(
-    _srv: Arc<State>,
+    srv: Arc<State>,
     rev: AdmissionReview<v1alpha1::Indexer>,
 ) -> Result<Json<AdmissionReview<DynamicObject>>, StatusCode> {
     let req: AdmissionRequest<v1alpha1::Indexer> = match rev.try_into() {
@@ -324,12 +353,19 @@ async fn validate_v1alpha1_indexer(
         }
     };
     let res = AdmissionResponse::from(&req);
-    info!("TODO");
+    if let Some(cfgsrc) = changed_config(&req, |o| o.spec.config.as_ref()) {
+        match missing_config(&srv.client, req.namespace.as_deref(), cfgsrc).await {
+            Ok(Some(msg)) => return Ok(Json(res.deny(msg).into_review())),
+            Ok(None) => trace!(op = ?req.operation, "config OK"),
+            Err(err) => return Ok(Json(AdmissionResponse::invalid(err).into_review())),
+        };
+    }
+    info!("OK");
     Ok(Json(res.into_review()))
 }
 #[instrument(skip_all)]
 async fn validate_v1alpha1_matcher(
-    _srv: Arc<State>,
+    srv: Arc<State>,
     rev: AdmissionReview<v1alpha1::Matcher>,
 ) -> Result<Json<AdmissionReview<DynamicObject>>, StatusCode> {
     let req: AdmissionRequest<v1alpha1::Matcher> = match rev.try_into() {
@@ -340,12 +376,19 @@ async fn validate_v1alpha1_matcher(
         }
     };
     let res = AdmissionResponse::from(&req);
-    info!("TODO");
+    if let Some(cfgsrc) = changed_config(&req, |o| o.spec.config.as_ref()) {
+        match missing_config(&srv.client, req.namespace.as_deref(), cfgsrc).await {
+            Ok(Some(msg)) => return Ok(Json(res.deny(msg).into_review())),
+            Ok(None) => trace!(op = ?req.operation, "config OK"),
+            Err(err) => return Ok(Json(AdmissionResponse::invalid(err).into_review())),
+        };
+    }
+    info!("OK");
     Ok(Json(res.into_review()))
 }
 #[instrument(skip_all)]
 async fn validate_v1alpha1_notifier(
-    _srv: Arc<State>,
+    srv: Arc<State>,
     rev: AdmissionReview<v1alpha1::Notifier>,
 ) -> Result<Json<AdmissionReview<DynamicObject>>, StatusCode> {
     let req: AdmissionRequest<v1alpha1::Notifier> = match rev.try_into() {
@@ -356,9 +399,94 @@ async fn validate_v1alpha1_notifier(
         }
     };
     let res = AdmissionResponse::from(&req);
-    info!("TODO");
+    if let Some(cfgsrc) = changed_config(&req, |o| o.spec.config.as_ref()) {
+        match missing_config(&srv.client, req.namespace.as_deref(), cfgsrc).await {
+            Ok(Some(msg)) => return Ok(Json(res.deny(msg).into_review())),
+            Ok(None) => trace!(op = ?req.operation, "config OK"),
+            Err(err) => return Ok(Json(AdmissionResponse::invalid(err).into_review())),
+        };
+    }
+    info!("OK");
     Ok(Json(res.into_review()))
 }
+/// Changed_config returns the ConfigSource that needs checking for the request `req`.
+///
+/// Only creates and updates that change the ConfigSource are checked, so that an object whose
+/// config has since gone missing can still have its status updated or be deleted.
+fn changed_config<'a, K>(
+    req: &'a AdmissionRequest<K>,
+    config: impl Fn(&'a K) -> Option<&'a v1alpha1::ConfigSource>,
+) -> Option<&'a v1alpha1::ConfigSource>
+where
+    K: kube::Resource,
+{
+    let cur = match req.operation {
+        Operation::Create | Operation::Update => req.object.as_ref()?,
+        _ => return None,
+    };
+    if cur.meta().deletion_timestamp.is_some() {
+        return None;
+    }
+    let cfgsrc = config(cur)?;
+    if req.operation == Operation::Update
+        && req.old_object.as_ref().and_then(&config) == Some(cfgsrc)
+    {
+        return None;
+    }
+    Some(cfgsrc)
+}
+/// Missing_config reports the first ConfigMap, Secret, or key referenced by `cfgsrc` that doesn't
+/// exist in the namespace `ns`, as a message for denying the request.
+async fn missing_config(
+    client: &kube::Client,
+    ns: Option<&str>,
+    cfgsrc: &v1alpha1::ConfigSource,
+) -> kube::Result<Option<String>> {
+    use clair_config::{ConfigObject, K8sMap};
+
+    fn check(obj: Option<ConfigObject>, kind: &str, name: &str, key: &str) -> Option<String> {
+        match obj {
+            None => Some(format!("no such {kind}: {name}")),
+            Some(obj) if obj.value(key.to_string()).is_none() => {
+                Some(format!("{kind} {name} has no key {key:?}"))
+            }
+            Some(_) => None,
+        }
+    }
+
+    let (cm_api, sec_api): (Api<core::v1::ConfigMap>, Api<core::v1::Secret>) = match ns {
+        Some(ns) => (
+            Api::namespaced(client.clone(), ns),
+            Api::namespaced(client.clone(), ns),
+        ),
+        None => (
+            Api::default_namespaced(client.clone()),
+            Api::default_namespaced(client.clone()),
+        ),
+    };
+
+    let root = &cfgsrc.root;
+    let obj = cm_api.get_opt(&root.name).await?.map(ConfigObject::from);
+    if let Some(msg) = check(obj, "ConfigMap", &root.name, &root.key) {
+        return Ok(Some(msg));
+    }
+    for (i, d) in cfgsrc.dropins.iter().enumerate() {
+        let msg = if let Some(r) = &d.config_map_key_ref {
+            let obj = cm_api.get_opt(&r.name).await?.map(ConfigObject::from);
+            check(obj, "ConfigMap", &r.name, &r.key)
+        } else if let Some(r) = &d.secret_key_ref {
+            let obj = sec_api.get_opt(&r.name).await?.map(ConfigObject::from);
+            check(obj, "Secret", &r.name, &r.key)
+        } else {
+            Some(format!("invalid dropin at index {i}: no ref specified"))
+        };
+        if msg.is_some() {
+            return Ok(msg);
+        }
+    }
+    Ok(None)
+}
+
 #[instrument(skip_all)]
 async fn validate_v1alpha1_updater(
     _srv: Arc<State>,
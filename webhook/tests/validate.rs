@@ -60,3 +60,220 @@ async fn validate() {
     let response = rev.response.unwrap();
     assert!(!response.allowed);
 }
+
+#[test(tokio::test)]
+async fn validate_indexer_missing_config() {
+    use v1alpha1::{ConfigMapKeySelector, ConfigSource, Indexer, IndexerSpec};
+
+    let idx = Indexer::new(
+        "test",
+        IndexerSpec {
+            config: Some(ConfigSource {
+                root: ConfigMapKeySelector {
+                    name: "clair-operator-test-missing".into(),
+                    key: "config.json".into(),
+                },
+                dropins: vec![],
+            }),
+            ..Default::default()
+        },
+    );
+    let response = review_indexer("CREATE", &idx, None).await;
+    assert!(!response.allowed);
+    assert!(response
+        .result
+        .message
+        .contains("no such ConfigMap: clair-operator-test-missing"));
+}
+
+/// Review sends an AdmissionReview for `obj` of the resource `resource` with the operation `op`
+/// and returns the response.
+async fn review<K>(
+    resource: &str,
+    op: &str,
+    obj: &K,
+    old: Option<&K>,
+) -> kube::core::admission::AdmissionResponse
+where
+    K: kube::Resource<DynamicType = ()> + serde::Serialize + serde::de::DeserializeOwned,
+{
+    let app = app().await;
+    let adm: Vec<u8> = to_vec(&json!({
+        "apiVersion": "admission.k8s.io/v1",
+        "kind": "AdmissionReview",
+        "request":{
+            "kind": {
+                "group": K::group(&()),
+                "version": K::version(&()),
+                "kind": K::kind(&()),
+            },
+            "resource": {
+                "group": K::group(&()),
+                "version": K::version(&()),
+                "resource": resource,
+            },
+            "uid": "00",
+            "name": "test",
+            "namespace": "default",
+            "operation": op,
+            "object": obj,
+            "oldObject": old,
+            "userInfo":{
+                "username": "admin",
+                "uid": "0",
+                "groups": ["admin"],
+            },
+        },
+    }))
+    .expect("JSON serialization failure");
+    let response = app
+        .oneshot(
+            Request::post("/v1alpha1/validate")
+                .header("content-type", "application/json")
+                .header("accept", "application/json")
+                .body(adm.into())
+                .expect("unable to build request"),
+        )
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    let buf = hyper::body::to_bytes(response.into_body())
+        .await
+        .expect("error reading response body");
+    let rev: AdmissionReview<K> = from_slice(&buf).expect("error deserializing response");
+    rev.response.expect("missing response")
+}
+
+/// Review_indexer sends an AdmissionReview for `idx` with the operation `op` and returns the
+/// response.
+async fn review_indexer(
+    op: &str,
+    idx: &v1alpha1::Indexer,
+    old: Option<&v1alpha1::Indexer>,
+) -> kube::core::admission::AdmissionResponse {
+    review("indexers", op, idx, old).await
+}
+
+/// Create_if_missing creates `obj` in the "default" namespace, unless it already exists.
+async fn create_if_missing<K>(obj: K)
+where
+    K: kube::Resource<DynamicType = (), Scope = k8s_openapi::NamespaceResourceScope>
+        + Clone
+        + std::fmt::Debug
+        + serde::Serialize
+        + serde::de::DeserializeOwned,
+{
+    use kube::api::{Api, PostParams};
+
+    let client = kube::Client::try_default()
+        .await
+        .expect("unable to create client");
+    let api: Api<K> = Api::namespaced(client, "default");
+    let name = obj.meta().name.clone().expect("object has no name");
+    if api.get_opt(&name).await.expect("API error").is_some() {
+        return;
+    }
+    match api.create(&PostParams::default(), &obj).await {
+        Ok(_) => (),
+        Err(kube::Error::Api(err)) if err.code == 409 => (),
+        Err(err) => panic!("unable to create {}: {err}", K::kind(&())),
+    }
+}
+
+/// Test_config makes sure the ConfigMap "clair-operator-test-config" with the key "config.json"
+/// exists and returns an Indexer using `key` of it as the root config.
+async fn test_config(key: &str) -> v1alpha1::Indexer {
+    use k8s_openapi::api::core::v1::ConfigMap;
+    use v1alpha1::{ConfigMapKeySelector, ConfigSource, Indexer, IndexerSpec};
+
+    let name = "clair-operator-test-config";
+    let mut cm = ConfigMap::default();
+    cm.metadata.name = Some(name.into());
+    cm.data = Some([("config.json".to_string(), "{}".to_string())].into());
+    create_if_missing(cm).await;
+    Indexer::new(
+        "test",
+        IndexerSpec {
+            config: Some(ConfigSource {
+                root: ConfigMapKeySelector {
+                    name: name.into(),
+                    key: key.into(),
+                },
+                dropins: vec![],
+            }),
+            ..Default::default()
+        },
+    )
+}
+
+#[test(tokio::test)]
+async fn validate_indexer_missing_key() {
+    let idx = test_config("missing.json").await;
+    let response = review_indexer("CREATE", &idx, None).await;
+    assert!(!response.allowed);
+    assert!(response
+        .result
+        .message
+        .contains("ConfigMap clair-operator-test-config has no key \"missing.json\""));
+}
+
+#[test(tokio::test)]
+async fn validate_indexer_config_ok() {
+    let idx = test_config("config.json").await;
+    let response = review_indexer("CREATE", &idx, None).await;
+    assert!(response.allowed, "{}", response.result.message);
+}
+
+#[test(tokio::test)]
+async fn validate_indexer_unchanged_config() {
+    let idx = test_config("missing.json").await;
+    let response = review_indexer("UPDATE", &idx, Some(&idx)).await;
+    assert!(response.allowed, "{}", response.result.message);
+}
+
+#[test(tokio::test)]
+async fn validate_clair_lints() {
+    use k8s_openapi::api::core::v1::{ConfigMap, Secret};
+    use v1alpha1::{Clair, ClairSpec, Databases, SecretKeySelector};
+
+    let name = "clair-operator-lint";
+    // An overly large scanlock_retry is valid, but linted.
+    let mut cm = ConfigMap::default();
+    cm.metadata.name = Some(format!("{name}-config"));
+    cm.data = Some(
+        [(
+            "config.json".to_string(),
+            r#"{"indexer":{"scanlock_retry":20}}"#.to_string(),
+        )]
+        .into(),
+    );
+    create_if_missing(cm).await;
+    let mut sec = Secret::default();
+    sec.metadata.name = Some(format!("{name}-db"));
+    sec.string_data = Some([("config.json".to_string(), "{}".to_string())].into());
+    create_if_missing(sec).await;
+
+    let db = SecretKeySelector {
+        name: format!("{name}-db"),
+        key: "config.json".into(),
+    };
+    let clair = Clair::new(
+        name,
+        ClairSpec {
+            databases: Some(Databases {
+                indexer: db.clone(),
+                matcher: db,
+                notifier: None,
+            }),
+            ..Default::default()
+        },
+    );
+    let response = review("clairs", "CREATE", &clair, None).await;
+    let warnings = response.warnings.unwrap_or_default();
+    assert!(
+        warnings
+            .iter()
+            .any(|w| w.contains("large values will increase latency")),
+        "lint missing from warnings: {warnings:?}"
+    );
+}
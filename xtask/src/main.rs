@@ -104,6 +104,58 @@ fn main() {
                         .default_value(CONFIG_DIR.join("crd").into_os_string())
                         .value_hint(ValueHint::DirPath),
                 ]),
+            Command::new("rbac")
+                .about("generate namespaced RBAC for running with `--watch-namespaces`")
+                .args(&[
+                    Arg::new("namespaces")
+                        .long("namespaces")
+                        .value_name("NS,...")
+                        .help("comma-separated namespaces the operator watches")
+                        .long_help("Comma-separated namespaces the operator watches.\nThese should be the same namespaces passed to the operator's `--watch-namespaces` flag.")
+                        .required(true)
+                        .value_delimiter(',')
+                        .action(ArgAction::Append),
+                    Arg::new("operator_namespace")
+                        .long("operator-namespace")
+                        .value_name("NS")
+                        .help("namespace the operator runs in")
+                        .long_help("Namespace the operator runs in.\nThe operator keeps its Lease and webhook certificates here, so it's always granted access to it.")
+                        .default_value("clair-system"),
+                    Arg::new("service_account")
+                        .long("service-account")
+                        .value_name("NAME")
+                        .help("service account the operator runs as")
+                        .default_value("clair-controller-manager"),
+                    Arg::new("out_dir")
+                        .long("out-dir")
+                        .value_name("DIR")
+                        .help("RBAC output directory")
+                        .long_help("RBAC output directory.\nA kustomization is written here holding a Role and RoleBinding per namespace, plus a ClusterRole and ClusterRoleBinding for the cluster-scoped resources the operator needs.")
+                        .default_value("target/rbac")
+                        .value_hint(ValueHint::DirPath),
+                ]),
+            Command::new("schemas")
+                .about("generate JSON Schema documents for the custom resources")
+                .args(&[
+                    Arg::new("out_dir")
+                        .long("out-dir")
+                        .value_name("DIR")
+                        .help("schema output directory")
+                        .long_help("Schema output directory.\nOne draft-07 JSON Schema document is written per kind, for use in editors and policy checks.")
+                        .default_value("target/schema")
+                        .value_hint(ValueHint::DirPath),
+                ]),
+            Command::new("docs")
+                .about("generate API reference documentation for the custom resources")
+                .args(&[
+                    Arg::new("out_dir")
+                        .long("out-dir")
+                        .value_name("DIR")
+                        .help("documentation output directory")
+                        .long_help("Documentation output directory.\nOne markdown document is written per kind, generated from the CRD schemas and their field descriptions.")
+                        .default_value("target/docs")
+                        .value_hint(ValueHint::DirPath),
+                ]),
             Command::new("install").about("install CRDs into the current kubernetes cluster"),
             Command::new("uninstall").about("uninstall CRDs from the current kubernetes cluster"),
             Command::new("deploy").about("install controller into the current kubernetes cluster").args(&deploy_args),
@@ -128,8 +180,11 @@ fn main() {
         Some(("ci", m)) => ci(m.into()),
         Some(("demo", m)) => demo(m.into()),
         Some(("deploy", m)) => deploy(sh, m.into()),
+        Some(("docs", m)) => docs(m.get_one::<String>("out_dir").unwrap()),
         Some(("install", _)) => install(sh),
         Some(("manifests", _)) => manifests(),
+        Some(("rbac", m)) => rbac(m.into()),
+        Some(("schemas", m)) => schemas(m.get_one::<String>("out_dir").unwrap()),
         Some(("undeploy", m)) => undeploy(sh, m.into()),
         Some(("uninstall", _)) => uninstall(sh),
         Some((unknown, _)) => Err(format!("unknown subcommand: {unknown}").into()),
@@ -410,6 +465,277 @@ where
     Ok(())
 }
 
+struct RbacOpts {
+    namespaces: Vec<String>,
+    operator_namespace: String,
+    service_account: String,
+    out_dir: PathBuf,
+}
+impl From<&clap::ArgMatches> for RbacOpts {
+    fn from(m: &clap::ArgMatches) -> Self {
+        let mut out_dir = m.get_one::<String>("out_dir").map(PathBuf::from).unwrap();
+        if !out_dir.is_absolute() {
+            out_dir = WORKSPACE.join(out_dir);
+        }
+        Self {
+            namespaces: m
+                .get_many::<String>("namespaces")
+                .unwrap_or_default()
+                .cloned()
+                .collect(),
+            operator_namespace: m.get_one::<String>("operator_namespace").unwrap().clone(),
+            service_account: m.get_one::<String>("service_account").unwrap().clone(),
+            out_dir,
+        }
+    }
+}
+
+/// Rbac splits the manager ClusterRole into a Role per watched namespace and a ClusterRole holding
+/// only the cluster-scoped rules, so the operator doesn't need cluster-wide access to Secrets.
+fn rbac(opts: RbacOpts) -> Result<()> {
+    use std::fs;
+
+    use k8s_openapi::api::rbac::v1::{
+        ClusterRole, ClusterRoleBinding, PolicyRule, Role, RoleBinding, RoleRef, Subject,
+    };
+    use kube::core::ObjectMeta;
+
+    // These groups only hold cluster-scoped resources.
+    const CLUSTER_GROUPS: [&str; 3] = [
+        "admissionregistration.k8s.io",
+        "apiextensions.k8s.io",
+        "config.openshift.io",
+    ];
+    const NAME: &str = "clair-manager-role";
+
+    let role: ClusterRole = serde_yaml::from_slice(&fs::read(CONFIG_DIR.join("rbac/role.yaml"))?)?;
+    let (cluster, namespaced): (Vec<PolicyRule>, Vec<PolicyRule>) =
+        role.rules.unwrap_or_default().into_iter().partition(|r| {
+            r.api_groups
+                .iter()
+                .flatten()
+                .any(|g| CLUSTER_GROUPS.contains(&g.as_str()))
+        });
+    let subjects = Some(vec![Subject {
+        kind: "ServiceAccount".into(),
+        name: opts.service_account.clone(),
+        namespace: Some(opts.operator_namespace.clone()),
+        api_group: None,
+    }]);
+    let role_ref = |kind: &str| RoleRef {
+        api_group: "rbac.authorization.k8s.io".into(),
+        kind: kind.into(),
+        name: NAME.into(),
+    };
+    let meta = |ns: Option<&String>| ObjectMeta {
+        name: Some(NAME.into()),
+        namespace: ns.cloned(),
+        ..Default::default()
+    };
+
+    fs::create_dir_all(&opts.out_dir)?;
+    eprintln!("# writing to dir: {}", opts.out_dir.display());
+    let mut resources = Vec::new();
+    let mut write = |name: String, docs: [serde_json::Value; 2]| -> Result<()> {
+        let mut buf = String::new();
+        for doc in docs {
+            buf.push_str("---\n");
+            buf.push_str(&serde_yaml::to_string(&doc)?);
+        }
+        fs::write(opts.out_dir.join(&name), buf)?;
+        eprintln!("# wrote: {name}");
+        resources.push(name);
+        Ok(())
+    };
+
+    write(
+        "cluster_role.yaml".into(),
+        [
+            serde_json::to_value(ClusterRole {
+                metadata: meta(None),
+                rules: Some(cluster),
+                ..Default::default()
+            })?,
+            serde_json::to_value(ClusterRoleBinding {
+                metadata: meta(None),
+                role_ref: role_ref("ClusterRole"),
+                subjects: subjects.clone(),
+            })?,
+        ],
+    )?;
+    let mut namespaces = opts.namespaces.clone();
+    namespaces.push(opts.operator_namespace.clone());
+    namespaces.sort();
+    namespaces.dedup();
+    for ns in &namespaces {
+        write(
+            format!("role_{ns}.yaml"),
+            [
+                serde_json::to_value(Role {
+                    metadata: meta(Some(ns)),
+                    rules: Some(namespaced.clone()),
+                })?,
+                serde_json::to_value(RoleBinding {
+                    metadata: meta(Some(ns)),
+                    role_ref: role_ref("Role"),
+                    subjects: subjects.clone(),
+                })?,
+            ],
+        )?;
+    }
+    let kustomization = serde_json::json!({
+        "apiVersion": "kustomize.config.k8s.io/v1beta1",
+        "kind": "Kustomization",
+        "resources": resources,
+    });
+    fs::write(
+        opts.out_dir.join("kustomization.yaml"),
+        serde_yaml::to_string(&kustomization)?,
+    )?;
+    eprintln!("# wrote: kustomization.yaml");
+    Ok(())
+}
+
+macro_rules! write_schemas {
+    ($out_dir:ident,  $($kind:ty),+ $(,)?) =>{
+        eprintln!("# writing to dir: {}", $out_dir.display());
+        $( write_schema::<$kind, _>($out_dir)?; )+
+    }
+}
+
+fn schemas<P: AsRef<Path>>(out_dir: P) -> Result<()> {
+    use api::v1alpha1;
+    let out = &WORKSPACE.join(out_dir);
+    std::fs::create_dir_all(out)?;
+    write_schemas!(
+        out,
+        v1alpha1::Clair,
+        v1alpha1::Indexer,
+        v1alpha1::Matcher,
+        v1alpha1::Updater,
+        v1alpha1::Notifier,
+    );
+    Ok(())
+}
+
+fn write_schema<K, P>(out_dir: P) -> Result<()>
+where
+    K: Resource<DynamicType = ()> + schemars::JsonSchema,
+    P: AsRef<Path>,
+{
+    use schemars::gen::SchemaSettings;
+    use std::fs::File;
+
+    let schema = SchemaSettings::draft07()
+        .into_generator()
+        .into_root_schema_for::<K>();
+    let out = out_dir
+        .as_ref()
+        .join(format!("{}.json", K::kind(&()).to_ascii_lowercase()));
+    let w = File::create(&out)?;
+    serde_json::to_writer_pretty(&w, &schema)?;
+    eprintln!("# wrote: {}", out.file_name().unwrap().to_string_lossy());
+    Ok(())
+}
+
+macro_rules! write_docs {
+    ($out_dir:ident,  $($kind:ty),+ $(,)?) =>{
+        eprintln!("# writing to dir: {}", $out_dir.display());
+        $( write_doc::<$kind, _>($out_dir)?; )+
+    }
+}
+
+fn docs<P: AsRef<Path>>(out_dir: P) -> Result<()> {
+    use api::v1alpha1;
+    let out = &WORKSPACE.join(out_dir);
+    std::fs::create_dir_all(out)?;
+    write_docs!(
+        out,
+        v1alpha1::Clair,
+        v1alpha1::Indexer,
+        v1alpha1::Matcher,
+        v1alpha1::Updater,
+        v1alpha1::Notifier,
+    );
+    Ok(())
+}
+
+fn write_doc<K, P>(out_dir: P) -> Result<()>
+where
+    K: Resource<DynamicType = ()> + CustomResourceExt,
+    P: AsRef<Path>,
+{
+    use std::fmt::Write;
+
+    let crd = serde_json::to_value(K::crd())?;
+    let schema = &crd["spec"]["versions"][0]["schema"]["openAPIV3Schema"];
+    let mut buf = String::new();
+    writeln!(buf, "# {}\n", K::kind(&()))?;
+    writeln!(buf, "`{}`\n", K::api_version(&()))?;
+    if let Some(d) = schema["description"].as_str() {
+        writeln!(buf, "{d}\n")?;
+    }
+    writeln!(buf, "| Field | Type | Required | Description |")?;
+    writeln!(buf, "| --- | --- | --- | --- |")?;
+    doc_fields(&mut buf, "", schema)?;
+
+    let out = out_dir
+        .as_ref()
+        .join(format!("{}.md", K::kind(&()).to_ascii_lowercase()));
+    std::fs::write(&out, buf)?;
+    eprintln!("# wrote: {}", out.file_name().unwrap().to_string_lossy());
+    Ok(())
+}
+
+/// Doc_fields writes a table row for every property of `schema`, recursing into objects and
+/// arrays.
+fn doc_fields(buf: &mut String, prefix: &str, schema: &serde_json::Value) -> Result<()> {
+    use std::fmt::Write;
+
+    let required: Vec<&str> = schema["required"]
+        .as_array()
+        .map(|r| r.iter().filter_map(|v| v.as_str()).collect())
+        .unwrap_or_default();
+    let props = match schema["properties"].as_object() {
+        Some(p) => p,
+        None => return Ok(()),
+    };
+    for (name, prop) in props {
+        let mut path = if prefix.is_empty() {
+            name.to_string()
+        } else {
+            format!("{prefix}.{name}")
+        };
+        let (ty, inner) = match prop["type"].as_str() {
+            Some("array") => {
+                path.push_str("[]");
+                let items = &prop["items"];
+                let ty = items["type"].as_str().unwrap_or("object");
+                (format!("[]{ty}"), items)
+            }
+            Some(ty) => (ty.to_string(), prop),
+            None if prop["x-kubernetes-int-or-string"].as_bool() == Some(true) => {
+                ("int-or-string".to_string(), prop)
+            }
+            None => ("object".to_string(), prop),
+        };
+        let req = if required.contains(&name.as_str()) {
+            "yes"
+        } else {
+            ""
+        };
+        let desc = prop["description"]
+            .as_str()
+            .unwrap_or_default()
+            .replace('|', "\\|")
+            .replace("\n\n", "<br><br>")
+            .replace('\n', " ");
+        writeln!(buf, "| `{path}` | {ty} | {req} | {desc} |")?;
+        doc_fields(buf, &path, inner)?;
+    }
+    Ok(())
+}
+
 fn install(sh: Shell) -> Result<()> {
     let cargo: &Path = &CARGO;
     cmd!(sh, "{cargo} xtask manifests").run()?;